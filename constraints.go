@@ -0,0 +1,38 @@
+package muxer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Constraints that can be referred to by name, as in `:id{int}`. Anything
+// else between the braces is treated as a regular expression.
+var namedConstraints = map[string]string{
+	"int":  `-?[0-9]+`,
+	"uuid": `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+// Splits a parameter component, such as `:id{int}`, into the name of the
+// parameter and its constraint. The constraint is empty if there is none.
+func parseParam(component string) (name, constraint string) {
+	name = component[1:]
+	i := strings.IndexByte(name, '{')
+	if i < 0 || !strings.HasSuffix(name, "}") {
+		return name, ""
+	}
+	return name[:i], name[i+1 : len(name)-1]
+}
+
+// Compiles the constraint into a regular expression that has to match the
+// entire path component.
+func compileConstraint(constraint string) (*regexp.Regexp, error) {
+	if named, ok := namedConstraints[constraint]; ok {
+		constraint = named
+	}
+	pattern, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid constraint %s: %s", constraint, err)
+	}
+	return pattern, nil
+}
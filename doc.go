@@ -23,5 +23,27 @@ func main() {
 	panic(http.ListenAndServe(endpoint, mux))
 }
 ```
+
+## Middleware
+
+Middlewares are plain `func(http.Handler) http.Handler` values. Those passed to `Use` wrap every request that the muxer dispatches, while those passed as trailing arguments to an `Add*Handler` method only wrap that route.
+
+```go
+mux.Use(logging, auth)
+mux.AddGetHandlerFunc("/admin/:page", admin, requireAdmin)
+```
+
+## Groups and mounting
+
+Routes that share a prefix and middlewares can be added through a group, which adds them to the same muxer. An entirely separate `http.Handler`, including another muxer, can be mounted under a prefix, and it will only see the part of the path that comes after the prefix.
+
+```go
+mux.Group("/api/v1", func(g *muxer.Group) {
+	g.Use(auth)
+	g.AddGetHandlerFunc("/users/:id", showUser)
+})
+
+mux.Mount("/static", http.FileServer(http.Dir("public")))
+```
 */
 package muxer
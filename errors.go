@@ -0,0 +1,78 @@
+package muxer
+
+import (
+	"fmt"
+)
+
+// ConflictError is returned when a route can't be added, because it clashes
+// with a route that had been added before it.
+type ConflictError struct {
+	// The route that was being added.
+	Route string
+
+	// The route that had been added before.
+	Existing string
+
+	// Why the two routes can't coexist.
+	Reason string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf(
+		"route %s conflicts with route %s: %s",
+		e.Route,
+		e.Existing,
+		e.Reason,
+	)
+}
+
+// ParamError is returned when a route parameter is either missing, or can't be
+// converted into the requested type.
+type ParamError struct {
+	// The name of the parameter.
+	Name string
+
+	// The value of the parameter. Empty if the parameter is missing.
+	Value string
+
+	// Why the value could not be converted. Nil if the parameter is missing.
+	Err error
+}
+
+func (e *ParamError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("parameter %s is missing", e.Name)
+	}
+	return fmt.Sprintf(
+		"parameter %s has malformed value %q: %s",
+		e.Name,
+		e.Value,
+		e.Err,
+	)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// RouteNotFoundError is returned when a route can't be removed, because it had
+// never been added, or it has already been removed.
+type RouteNotFoundError struct {
+	// The method that the route was being removed for. Empty if the route was
+	// being removed for every method.
+	Method string
+
+	// The route that was being removed.
+	Route string
+}
+
+func (e *RouteNotFoundError) Error() string {
+	if len(e.Method) <= 0 {
+		return fmt.Sprintf("route %s has not been added", e.Route)
+	}
+	return fmt.Sprintf(
+		"route %s has not been added for method %s",
+		e.Route,
+		e.Method,
+	)
+}
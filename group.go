@@ -0,0 +1,248 @@
+package muxer
+
+import (
+	"net/http"
+)
+
+// Group adds routes to a muxer under a shared prefix, wrapping each of them
+// with a shared stack of middlewares. The routes end up in the same routes tree
+// as the ones added directly to the muxer, and so the muxer's own middlewares
+// still apply to them.
+type Group struct {
+	muxer       *Muxer
+	routes      *routeTable
+	prefix      string
+	middlewares []func(http.Handler) http.Handler
+}
+
+// Group calls the function with a group whose routes all begin with the given
+// prefix.
+func (m *Muxer) Group(prefix string, fn func(g *Group)) {
+	fn(&Group{muxer: m, routes: m.routes, prefix: prefix})
+}
+
+// Group calls the function with a group nested inside this one. The nested
+// group's routes begin with both prefixes, and they are wrapped by the
+// middlewares of both groups.
+func (g *Group) Group(prefix string, fn func(g *Group)) {
+	// Capping the capacity makes sure that the nested group appending its own
+	// middlewares never writes into this group's slice.
+	n := len(g.middlewares)
+	fn(&Group{
+		muxer:       g.muxer,
+		routes:      g.routes,
+		prefix:      joinRoutes(g.prefix, prefix),
+		middlewares: g.middlewares[:n:n],
+	})
+}
+
+// Use adds middlewares that will wrap every route added to the group from here
+// on. They run after the muxer's middlewares, but before the middlewares that
+// were supplied alongside a specific route.
+func (g *Group) Use(mw ...func(http.Handler) http.Handler) {
+	g.middlewares = append(g.middlewares, mw...)
+}
+
+// Puts the group's middlewares in front of the route's middlewares.
+func (g *Group) withMiddlewares(
+	mw []func(http.Handler) http.Handler,
+) []func(http.Handler) http.Handler {
+	result := make(
+		[]func(http.Handler) http.Handler,
+		0,
+		len(g.middlewares)+len(mw),
+	)
+	result = append(result, g.middlewares...)
+	return append(result, mw...)
+}
+
+// Name gives a name to a route that has already been added to the group.
+func (g *Group) Name(name, route string) error {
+	return g.muxer.name(g.routes, name, joinRoutes(g.prefix, route))
+}
+
+// AddGetHandler adds an http.Handler associated with a GET request to the
+// specified route.
+func (g *Group) AddGetHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddCustomMethodHandler("GET", route, h, mw...)
+}
+
+// AddGetHandlerFunc adds a GET http.HandlerFunc associated with a GET request
+// to the specified route.
+func (g *Group) AddGetHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddGetHandler(route, h, mw...)
+}
+
+// AddPostHandler adds an http.Handler associated with a POST request to the
+// specified route.
+func (g *Group) AddPostHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddCustomMethodHandler("POST", route, h, mw...)
+}
+
+// AddPostHandlerFunc adds a POST http.HandlerFunc associated with a POST
+// request to the specified route.
+func (g *Group) AddPostHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddPostHandler(route, h, mw...)
+}
+
+// AddPutHandler adds an http.Handler associated with a PUT request to the
+// specified route.
+func (g *Group) AddPutHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddCustomMethodHandler("PUT", route, h, mw...)
+}
+
+// AddPutHandlerFunc adds an http.HandlerFunc associated with a PUT request to
+// the specified route.
+func (g *Group) AddPutHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddPutHandler(route, h, mw...)
+}
+
+// AddDeleteHandler adds an http.Handler associated with a DELETE request to the
+// specified route.
+func (g *Group) AddDeleteHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddCustomMethodHandler("DELETE", route, h, mw...)
+}
+
+// AddDeleteHandlerFunc adds an http.HandlerFunc associated with a DELETE
+// request to the specified route.
+func (g *Group) AddDeleteHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddDeleteHandler(route, h, mw...)
+}
+
+// AddPatchHandler adds an http.Handler associated with a PATCH request to the
+// specified route.
+func (g *Group) AddPatchHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddCustomMethodHandler("PATCH", route, h, mw...)
+}
+
+// AddPatchHandlerFunc adds an http.HandlerFunc associated with a PATCH request
+// to the specified route.
+func (g *Group) AddPatchHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddPatchHandler(route, h, mw...)
+}
+
+// AddCustomMethodHandler adds an http.Handler associated with a custom method
+// to the specified route.
+func (g *Group) AddCustomMethodHandler(
+	method,
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.muxer.addHandlerMethod(
+		g.routes,
+		joinRoutes(g.prefix, route),
+		method,
+		h,
+		g.withMiddlewares(mw),
+	)
+}
+
+// AddCustomMethodHandlerFunc adds a http.HandlerFunc associated with a custom
+// method to the specified route.
+func (g *Group) AddCustomMethodHandlerFunc(
+	method,
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddCustomMethodHandler(method, route, h, mw...)
+}
+
+// AddMatchedHandler adds an http.Handler associated with the method to the
+// route under the group's prefix, which is only called for the requests that
+// satisfy every one of the matchers.
+func (g *Group) AddMatchedHandler(
+	method,
+	route string,
+	matchers []Matcher,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.muxer.addMatchedHandlerMethod(
+		g.routes,
+		joinRoutes(g.prefix, route),
+		method,
+		matchers,
+		h,
+		g.withMiddlewares(mw),
+	)
+}
+
+// AddMatchedHandlerFunc adds an http.HandlerFunc associated with the method to
+// the route under the group's prefix, which is only called for the requests
+// that satisfy every one of the matchers.
+func (g *Group) AddMatchedHandlerFunc(
+	method,
+	route string,
+	matchers []Matcher,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddMatchedHandler(method, route, matchers, h, mw...)
+}
+
+// AddHandler adds a http.Handler associated with any HTTP method request to the
+// specified route.
+func (g *Group) AddHandler(
+	path string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.muxer.addCatchAllHandler(
+		g.routes,
+		joinRoutes(g.prefix, path),
+		h,
+		g.withMiddlewares(mw),
+	)
+}
+
+// AddHandlerFunc adds a http.HandlerFunc associated with any HTTP method
+// request to the specified route.
+func (g *Group) AddHandlerFunc(
+	path string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.AddHandler(path, h, mw...)
+}
@@ -0,0 +1,152 @@
+package muxer
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// The routes that were added for hosts matching a specific pattern.
+type hostRoutes struct {
+	pattern string
+	regex   *regexp.Regexp
+	names   []string
+	routes  *routeTable
+
+	// Whether the requests that none of the host's routes accept should be
+	// routed using the routes that were added to the muxer directly.
+	fallback bool
+}
+
+// Compiles a host pattern, such as `{tenant}.example.com`, into a regular
+// expression. Every `{name}` matches a single label of the host name.
+func compileHost(pattern string) (*regexp.Regexp, []string, error) {
+	names := []string{}
+	var expression strings.Builder
+	expression.WriteString("^")
+	remainder := strings.ToLower(pattern)
+	for len(remainder) > 0 {
+		start := strings.IndexByte(remainder, '{')
+		if start < 0 {
+			expression.WriteString(regexp.QuoteMeta(remainder))
+			break
+		}
+		end := strings.IndexByte(remainder[start:], '}')
+		if end < 0 {
+			return nil, nil, fmt.Errorf("host %s has an unclosed brace", pattern)
+		}
+		end += start
+		name := remainder[start+1 : end]
+		if len(name) <= 0 {
+			return nil, nil, fmt.Errorf("host %s has an unnamed part", pattern)
+		}
+		expression.WriteString(regexp.QuoteMeta(remainder[:start]))
+		expression.WriteString("([^.]+)")
+		names = append(names, name)
+		remainder = remainder[end+1:]
+	}
+	expression.WriteString("$")
+
+	regex, err := regexp.Compile(expression.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return regex, names, nil
+}
+
+// Host calls the function with a group whose routes only apply to requests
+// whose host matches the pattern. Parts of the pattern wrapped in braces, as
+// in `{tenant}.example.com`, each match a single label of the host name, and
+// they are made available through Params.
+//
+// Hosts are matched without regard to case or port. Hosts without parameters
+// are tried first, and then the ones with parameters, each in the order in
+// which they were first added. Requests whose host doesn't match any of the
+// patterns are routed using the routes that were added to the muxer directly.
+func (m *Muxer) Host(pattern string, fn func(g *Group)) error {
+	var host *hostRoutes
+	for _, existing := range m.hosts {
+		if existing.pattern == pattern {
+			host = existing
+			break
+		}
+	}
+	if host == nil {
+		regex, names, err := compileHost(pattern)
+		if err != nil {
+			return err
+		}
+		host = &hostRoutes{
+			pattern: pattern,
+			regex:   regex,
+			names:   names,
+			routes:  newRouteTable(),
+		}
+		m.insertHost(host)
+	}
+
+	fn(&Group{muxer: m, routes: host.routes})
+	return nil
+}
+
+// Inserts the host, making sure that hosts without any parameters stay ahead of
+// the ones with parameters, so that `api.example.com` is never mistaken for
+// `{tenant}.example.com`.
+func (m *Muxer) insertHost(host *hostRoutes) {
+	if len(host.names) > 0 {
+		m.hosts = append(m.hosts, host)
+		return
+	}
+	i := 0
+	for i < len(m.hosts) && len(m.hosts[i].names) <= 0 {
+		i++
+	}
+	m.hosts = append(m.hosts, nil)
+	copy(m.hosts[i+1:], m.hosts[i:])
+	m.hosts[i] = host
+}
+
+// SetHostFallback sets whether the requests for hosts matching the pattern
+// should be routed using the routes that were added to the muxer directly,
+// whenever none of the host's own routes accept them. The parameters captured
+// from the host are still available through Params. It is disabled by
+// default, and the host must have already been added through Host.
+func (m *Muxer) SetHostFallback(pattern string, enabled bool) error {
+	for _, host := range m.hosts {
+		if host.pattern == pattern {
+			host.fallback = enabled
+			return nil
+		}
+	}
+	return fmt.Errorf("host %s has not been added", pattern)
+}
+
+// Finds the routes for the host of the request, along with the parameters
+// captured from the host. Nil if none of the host patterns match.
+func (m *Muxer) matchHost(r *http.Request) (*hostRoutes, map[string]string) {
+	if len(m.hosts) <= 0 {
+		return nil, nil
+	}
+
+	name := r.Host
+	if hostname, _, err := net.SplitHostPort(name); err == nil {
+		name = hostname
+	}
+	name = strings.ToLower(name)
+
+	for _, host := range m.hosts {
+		matches := host.regex.FindStringSubmatch(name)
+		if matches == nil {
+			continue
+		}
+		params := make(map[string]string)
+		for i, param := range host.names {
+			params[param] = matches[i+1]
+		}
+		return host, params
+	}
+
+	return nil, nil
+}
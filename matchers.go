@@ -0,0 +1,84 @@
+package muxer
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Matcher determines whether a route accepts the request, beyond its path and
+// method. Handlers that were added with matchers are only called when every
+// one of their matchers returns true.
+type Matcher func(r *http.Request) bool
+
+// MatchHeader matches requests that have the header set to the given value.
+// Headers that hold comma separated lists, such as Accept, match if any of the
+// items in the list equals the value. An empty value only checks that the
+// header is present.
+func MatchHeader(name, value string) Matcher {
+	return func(r *http.Request) bool {
+		values, ok := r.Header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return false
+		}
+		if len(value) <= 0 {
+			return true
+		}
+		for _, v := range values {
+			for _, item := range strings.Split(v, ",") {
+				if strings.TrimSpace(item) == value {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// MatchQuery matches requests whose query string has the parameter set to the
+// given value. An empty value only checks that the parameter is present.
+func MatchQuery(name, value string) Matcher {
+	return func(r *http.Request) bool {
+		values, ok := r.URL.Query()[name]
+		if !ok {
+			return false
+		}
+		if len(value) <= 0 {
+			return true
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchContentType matches requests whose Content-Type is any of the given
+// media types. Parameters, such as the charset, are ignored.
+func MatchContentType(mediaTypes ...string) Matcher {
+	return func(r *http.Request) bool {
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return false
+		}
+		for _, t := range mediaTypes {
+			if strings.EqualFold(mediaType, t) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Determines whether the request satisfies every one of the handler's
+// matchers.
+func (h wrappedHandler) matchesRequest(r *http.Request) bool {
+	for _, matcher := range h.matchers {
+		if !matcher(r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package muxer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// A handler that is mounted under a prefix. The handler only ever gets to see
+// the part of the path that comes after the prefix.
+type strippedHandler struct {
+	handler http.Handler
+}
+
+func (h strippedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// By now, the offset points just past the prefix that the handler was
+	// mounted under.
+	offset, ok := r.Context().Value(pathOffsetContextKey).(int)
+	if !ok {
+		offset = 0
+	}
+
+	ctx := context.WithValue(r.Context(), pathOffsetContextKey, 0)
+	if _, ok := ctx.Value(originalURLContextKey).(*url.URL); !ok {
+		ctx = context.WithValue(ctx, originalURLContextKey, r.URL)
+	}
+	r2 := r.Clone(ctx)
+	if usesRawPath(r) {
+		stripEscapedComponents(r2.URL, offset)
+	} else {
+		stripComponents(r2.URL, offset)
+	}
+
+	h.handler.ServeHTTP(w, r2)
+}
+
+// Strips the first n components off the URL's path, and off its escaped form,
+// if it has one.
+func stripComponents(u *url.URL, n int) {
+	components := splitPath(u.Path)
+	if n > len(components) {
+		n = len(components)
+	}
+	prefix := "/" + strings.Join(components[:n], "/")
+	u.Path = "/" + strings.Join(components[n:], "/")
+
+	if len(u.RawPath) <= 0 {
+		return
+	}
+
+	// An escaped slash in the raw path won't split a component, and so we can't
+	// simply strip n components off of it. Instead, strip as many as it takes to
+	// get to the same prefix.
+	raw := strings.Split(u.RawPath[1:], "/")
+	unescaped := ""
+	i := 0
+	for ; i < len(raw) && len(unescaped) < len(prefix); i++ {
+		component, err := url.PathUnescape(raw[i])
+		if err != nil {
+			break
+		}
+		unescaped += "/" + component
+	}
+	if unescaped != prefix {
+		u.RawPath = ""
+		return
+	}
+	u.RawPath = "/" + strings.Join(raw[i:], "/")
+}
+
+// Strips the first n components off the URL's escaped path, for when the muxer
+// counted the components of the escaped path, rather than the unescaped one.
+func stripEscapedComponents(u *url.URL, n int) {
+	components := splitPath(u.EscapedPath())
+	if n > len(components) {
+		n = len(components)
+	}
+	escaped := "/" + strings.Join(components[n:], "/")
+	unescaped, err := url.PathUnescape(escaped)
+	if err != nil {
+		unescaped = escaped
+	}
+	u.Path = unescaped
+	u.RawPath = escaped
+}
+
+// Mount adds a handler that will handle every request whose path begins with
+// the prefix, regardless of the method. Before the handler is called, the
+// prefix is stripped off of a clone of the request, in the same way that
+// http.StripPrefix does, with URL.Path and URL.RawPath both being rewritten.
+//
+// Unlike AddHandler, this works the same for muxers and for any other kind of
+// http.Handler, even when they are nested. The parameters captured by the
+// prefix remain available through Params.
+func (m *Muxer) Mount(
+	prefix string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.addCatchAllHandler(
+		m.routes,
+		mountRoute(prefix),
+		strippedHandler{h},
+		mw,
+	)
+}
+
+// Mount adds a handler under the group's prefix. See Muxer.Mount.
+func (g *Group) Mount(
+	prefix string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return g.muxer.addCatchAllHandler(
+		g.routes,
+		mountRoute(joinRoutes(g.prefix, prefix)),
+		strippedHandler{h},
+		g.withMiddlewares(mw),
+	)
+}
+
+// Gets the wildcard route that catches everything under the prefix.
+func mountRoute(prefix string) string {
+	return strings.TrimSuffix(prefix, "/") + "/*"
+}
@@ -2,7 +2,10 @@ package muxer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 )
 
@@ -12,9 +15,10 @@ type key string
 // the URL parameters
 
 const (
-	pathContextKey               key = "muxer_pathContextKey"
-	pathOffsetContextKey         key = "muxer_pathOffsetContextKey"
-	previousPathOffsetContextKey key = "muxer_previousPathOffsetContextKey"
+	pathOffsetContextKey  key = "muxer_pathOffsetContextKey"
+	paramsContextKey      key = "muxer_paramsContextKey"
+	originalURLContextKey key = "muxer_originalURLContextKey"
+	rawPathContextKey     key = "muxer_rawPathContextKey"
 )
 
 // A type alias for a middleware.
@@ -31,26 +35,298 @@ func (n *middlewareNode) insert(value middleware) *middlewareNode {
 	return &middlewareNode{value, n}
 }
 
+// Wraps the supplied handler with every middleware in the linked list. The
+// head of the list holds the most recently inserted middleware, and so it ends
+// up being the innermost one. In other words, the middleware that was inserted
+// first will be the first one to see the request.
+func (n *middlewareNode) wrap(h http.Handler) http.Handler {
+	for node := n; node != nil; node = node.next {
+		h = node.value(h)
+	}
+	return h
+}
+
+// Creates a middlewares linked list out of a slice of middlewares.
+func newMiddlewareList(mw []func(http.Handler) http.Handler) *middlewareNode {
+	var list *middlewareNode
+	for _, value := range mw {
+		list = list.insert(value)
+	}
+	return list
+}
+
+// The innermost handler of the muxer's middlewares, which the middlewares that
+// are added later get plugged into.
+type middlewareTail struct {
+	next http.Handler
+}
+
+func (t *middlewareTail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.next.ServeHTTP(w, r)
+}
+
 // This is the struct that will serve as the intermediary HTTP handler that
 // will multiplex the routers that have been appened to the muxer.
 type wrapperServer struct {
-	muxer *Muxer
+	muxer Muxer
 }
 
 // Implementation of ServeHTTP that actually handles the multiplexing.
-func (ws wrapperServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (ws wrapperServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	m := ws.muxer
+
+	// We want to strip the prefix. But under what logic?
+	//
+	// No matter how nested this instance is, we will typically get the full URL
+	// path.
+	//
+	// And so, grab offset context variable, to strip out the prefix.
+	offset, ok := req.Context().Value(pathOffsetContextKey).(int)
+	if !ok {
+		offset = 0
+	}
+
+	req = withRawPath(req, m.useRawPath)
+
+	if m.cleanPath {
+		original := routingPath(req, originalURL(req))
+		if cleaned := cleanPath(original); cleaned != original {
+			redirect(w, req, cleaned)
+			return
+		}
+	}
+
+	// Extract the relevant part of the path.
+	pathComponents := splitPath(routingPath(req, req.URL))
+	if offset > len(pathComponents) {
+		offset = len(pathComponents)
+	}
+	pathComponents = pathComponents[offset:]
+	partialPath := "/" + strings.Join(pathComponents, "/")
+
+	host, params := m.matchHost(req)
+	if host != nil && len(params) > 0 {
+		req = withParams(req, params)
+	}
+
+	// Routes that serve the request's method take precedence over the ones that
+	// merely accept the path. Only when no route serves the method is the path
+	// looked up regardless of the method, which is what tells a path that
+	// doesn't exist apart from a method that isn't allowed.
+	result, matchedPath, redirectToCanonical :=
+		m.route(host, partialPath, m.acceptsMethod(req.Method))
+	if !result.accepted(acceptsRemainder) {
+		result, matchedPath, redirectToCanonical =
+			m.route(host, partialPath, acceptsRemainder)
+	}
+
+	// Or perhaps the path is off by case.
+	canonical := matchedPath
+	if len(result.canonical) > 0 && result.canonical != matchedPath {
+		canonical = result.canonical
+		redirectToCanonical =
+			redirectToCanonical || m.casePolicy == CaseRedirect
+	}
+
+	if redirectToCanonical {
+		// Regardless of what made the muxer look for an alternative path, the
+		// request's path differs from the canonical path by the same suffix.
+		target, ok := replaceMatchedPath(req, partialPath, canonical)
+		if ok {
+			redirect(w, req, target)
+			return
+		}
+	}
+
+	if !result.retrieved {
+		m.notFoundHandler.ServeHTTP(w, req)
+		return
+	}
+
+	switch handler := result.value.(type) {
+	case *routeHandler:
+		if handler == nil {
+			m.notFoundHandler.ServeHTTP(w, req)
+			return
+		}
+		h, ok := handler.handler(req.Method, req, result.remainder)
+		if ok {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		// Every other method is left to the handler for all methods, if any.
+		h, ok = handler.handler(anyMethod, req, result.remainder)
+		if ok {
+			h.ServeHTTP(w, req)
+			return
+		}
+		autoHead := req.Method == http.MethodHead && !m.disableAutoHead
 
+		// A HEAD request is just a GET request without the body.
+		if autoHead {
+			h, ok := handler.handler(http.MethodGet, req, result.remainder)
+			if ok {
+				h.ServeHTTP(headResponseWriter{w}, req)
+				return
+			}
+		}
+
+		// There are handlers for the method, but none of their matchers accept
+		// the request.
+		if handler.acceptsPath(req.Method, result.remainder) ||
+			autoHead && handler.acceptsPath(http.MethodGet, result.remainder) {
+			m.notFoundHandler.ServeHTTP(w, req)
+			return
+		}
+
+		// The path exists, but not for the requested method. Unless, of course,
+		// none of the methods accept the path.
+		allowed := m.allowedMethods(host, matchedPath)
+		if len(allowed) <= 0 {
+			m.notFoundHandler.ServeHTTP(w, req)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+
+		if req.Method == http.MethodOptions && !m.disableAutoOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		m.methodNotAllowedHandler.ServeHTTP(w, req)
+	default:
+		m.notFoundHandler.ServeHTTP(w, req)
+	}
+}
+
+// Looks up the path in the routes that were added for the host, if any, and
+// in the rest of the routes otherwise. Routes that were added for a specific
+// host take precedence over the rest. Unless the host falls back to the rest,
+// they are the only routes that the host's requests get.
+func (m *Muxer) route(
+	host *hostRoutes,
+	path string,
+	accept acceptor,
+) (partialRouteResult, string, bool) {
+	if host != nil {
+		result, matchedPath, redirect :=
+			m.match(host.routes.load(), path, accept)
+		if !host.fallback || result.accepted(accept) {
+			return result, matchedPath, redirect
+		}
+	}
+	return m.match(m.routes.load(), path, accept)
+}
+
+// Gets the acceptor for the requests with the given method, which only
+// accepts the handlers that can serve the method, whether on their own, or
+// through the handler for all methods, or, for HEAD requests, through the
+// handler for GET requests.
+func (m *Muxer) acceptsMethod(method string) acceptor {
+	autoHead := method == http.MethodHead && !m.disableAutoHead
+	return func(value interface{}, remainder string) bool {
+		handler, ok := value.(*routeHandler)
+		if !ok || handler == nil {
+			return false
+		}
+		return handler.acceptsPath(method, remainder) ||
+			handler.acceptsPath(anyMethod, remainder) ||
+			autoHead && handler.acceptsPath(http.MethodGet, remainder)
+	}
+}
+
+// Looks up the path in the routes tree, along with the path that only differs
+// by a trailing slash, if the muxer doesn't care about those. Besides the
+// result, it gets the path that was matched, and whether the request should be
+// redirected to it.
+func (m *Muxer) match(
+	tree *routes,
+	path string,
+	accept acceptor,
+) (partialRouteResult, string, bool) {
+	result := m.lookup(tree, path, accept)
+	if result.accepted(accept) || path == "/" ||
+		m.trailingSlashPolicy == TrailingSlashStrict {
+		return result, path, false
+	}
+	alternativePath := toggleTrailingSlash(path)
+	alternative := m.lookup(tree, alternativePath, accept)
+	if !alternative.accepted(accept) {
+		return result, path, false
+	}
+	return alternative,
+		alternativePath,
+		m.trailingSlashPolicy == TrailingSlashRedirect
+}
+
+// Looks up the path in the routes tree. If nothing accepts the path, and the
+// muxer doesn't care about case, then the lookup is retried while ignoring the
+// case of static components.
+func (m *Muxer) lookup(
+	tree *routes,
+	path string,
+	accept acceptor,
+) partialRouteResult {
+	mode := matchMode{unescape: m.useRawPath}
+	result := tree.getShortCircuitedWith(path, mode, accept)
+	if result.accepted(accept) || m.casePolicy == CaseSensitive {
+		return result
+	}
+	mode.foldCase = true
+	folded := tree.getShortCircuitedWith(path, mode, accept)
+	if folded.accepted(accept) {
+		return folded
+	}
+	return result
 }
 
 // TODO: determine if the field `routes` should not be a pointer.
 
 // Muxer the main muxer library.
+//
+// Routes can be added to the muxer, and to its groups, while it is serving
+// requests. Everything else, including middlewares, hosts, names and the
+// various policies, has to be set up before the muxer starts serving.
+//
+// Copies of a muxer share everything, and so setting up a copy of the muxer
+// sets up the muxer itself, and the other way around.
 type Muxer struct {
 	// TODO: have a way so that we don't need to call a constructor function.
 
-	routes          *routes
-	notFoundHandler http.Handler
-	middlewares     *middlewareNode
+	*muxerState
+}
+
+// Everything that makes up a muxer. It lives behind a pointer, so that the
+// muxer that NewMuxer returns, along with every copy of it, dispatches
+// requests the same way, no matter which of the copies was set up.
+type muxerState struct {
+	routes                  *routeTable
+	notFoundHandler         http.Handler
+	methodNotAllowedHandler http.Handler
+
+	// The muxer's middlewares wrapped around the muxer itself. They are wrapped
+	// as they are added, rather than on every request, so that each middleware
+	// is only ever constructed once. Middlewares added later are plugged into
+	// the tail. Both are nil without middlewares.
+	handler http.Handler
+	tail    *middlewareTail
+
+	// Maps route names to the route patterns that they were given to.
+	names map[string]namedRoute
+
+	// Every host has its own routes tree. The muxer's own routes tree is used
+	// for requests whose host doesn't match any of these.
+	hosts []*hostRoutes
+
+	// Both are enabled by default, hence the negation.
+	disableAutoHead    bool
+	disableAutoOptions bool
+
+	trailingSlashPolicy TrailingSlashPolicy
+	casePolicy          CasePolicy
+	cleanPath           bool
+	useRawPath          bool
 }
 
 // Just the handlerfunc used for the not found response.
@@ -59,14 +335,44 @@ func notFound(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Not found"))
 }
 
+// Just the handlerfunc used for the method not allowed response.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	w.Write([]byte("Method not allowed"))
+}
+
 // NewMuxer creates a new muxer instance.
 func NewMuxer() Muxer {
-	routes := newRouter()
-	return Muxer{
-		&routes,
-		http.HandlerFunc(notFound),
-		nil,
-	}
+	return Muxer{&muxerState{
+		routes:                  newRouteTable(),
+		notFoundHandler:         http.HandlerFunc(notFound),
+		methodNotAllowedHandler: http.HandlerFunc(methodNotAllowed),
+		names:                   make(map[string]namedRoute),
+	}}
+}
+
+// A handler that remembers the route pattern that it was registered under.
+type wrappedHandler struct {
+	path    string
+	handler http.Handler
+
+	// The route pattern as it was added, which can differ from the path if it
+	// has optional parts. The path is then one of the pattern's expansions.
+	pattern string
+
+	// The parameters in the path, along with where to find their values.
+	captures []segmentCapture
+
+	// Set on all but the first of the handlers that a pattern with optional
+	// parts was expanded into, so that the pattern is only ever listed once.
+	alias bool
+
+	// The handler as it was supplied, before any middleware was applied to it.
+	original http.Handler
+
+	// Only for method specific handlers. The request has to satisfy all of
+	// them, on top of the route pattern.
+	matchers []Matcher
 }
 
 // The purpose of this function is to handle path offsetting. Offsetting is done
@@ -74,149 +380,403 @@ func NewMuxer() Muxer {
 // handlers. The offset is incremented at every handler.
 //
 // The one caveat is that if a non muxer handler is supplied at any level, then
-// we would end up losing track. Maybe we might need to provide a workaround.
-func (m *Muxer) wrapHandler(path string, h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		pathOffset, ok := r.Context().Value(pathOffsetContextKey).(int)
-		if !ok {
-			pathOffset = 0
-		}
+// we would end up losing track. Mount works around this, by stripping the
+// prefix off of the request's path altogether.
+func (m *Muxer) wrapHandler(
+	path string,
+	h http.Handler,
+	mw []func(http.Handler) http.Handler,
+) wrappedHandler {
+	return wrappedHandler{
+		path:     path,
+		handler:  newMiddlewareList(mw).wrap(h),
+		pattern:  path,
+		original: h,
+	}
+}
 
-		pathNoWildcard := extractRelevantPath(path)
+// Determines whether the route pattern accepts the part of the request path
+// that was left over after walking the routes tree. Only wildcard routes are
+// allowed to have a remainder.
+func (h wrappedHandler) matches(remainder string) bool {
+	return len(remainder) <= 0 || pathHasWildcard(h.path)
+}
 
-		// The first slash is a distraction.
-		components := strings.Split(pathNoWildcard[1:], "/")
+func (h wrappedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	pathOffset, ok := r.Context().Value(pathOffsetContextKey).(int)
+	if !ok {
+		pathOffset = 0
+	}
 
-		if !pathHasWildcard(path) {
-			// Cut out the irrelevant stuff from the HTTP request.
-			relevantRequestPathComponents :=
-				strings.Split(r.URL.Path[1:], "/")[pathOffset:]
+	requestPathComponents := splitPath(routingPath(r, r.URL))
 
-			if len(components) != len(relevantRequestPathComponents) {
-				w.WriteHeader(404)
-				w.Write([]byte("Not found"))
-				return
-			}
-		}
+	// The route can have more components than the request path, when the two
+	// only differ by a trailing slash. The offset must never go past the end of
+	// the path.
+	newOffset := pathOffset + len(routeComponents(h.path))
+	if newOffset > len(requestPathComponents) {
+		newOffset = len(requestPathComponents)
+	}
 
-		newOffset := pathOffset + len(components)
+	ctx := context.WithValue(r.Context(), pathOffsetContextKey, newOffset)
+	r = r.WithContext(ctx)
+
+	// The parameters are named after this handler's own route pattern, rather
+	// than after whichever route happened to add the parameter to the routes
+	// tree first.
+	params := make(map[string]string)
+	for _, capture := range h.captures {
+		i := pathOffset + capture.index
+		if i >= len(requestPathComponents) {
+			continue
+		}
+		for name, value := range capture.values(requestPathComponents[i]) {
+			params[name] = unescapeCaptured(r, value)
+		}
+	}
 
-		ctx := context.WithValue(r.Context(), pathOffsetContextKey, newOffset)
-		ctx = context.WithValue(
-			ctx,
-			previousPathOffsetContextKey,
-			pathOffset,
-		)
-		ctx = context.WithValue(ctx, pathContextKey, path)
+	if name := wildcardName(h.path); len(name) > 0 {
+		var remainder string
+		if newOffset < len(requestPathComponents) {
+			remainder = strings.Join(requestPathComponents[newOffset:], "/")
+		}
+		params[name] = unescapeCaptured(r, remainder)
+	}
 
-		r = r.WithContext(ctx)
+	if len(params) > 0 {
+		r = withParams(r, params)
+	}
 
-		h.ServeHTTP(w, r)
-	})
+	h.handler.ServeHTTP(w, r)
 }
 
-// Determines if the given path ends with a wildcard character.
+// Determines if the given path ends with a wildcard, such as `/*` or
+// `/*filepath`.
 func pathHasWildcard(path string) bool {
 	components := strings.Split(path[1:], "/")
-	return components[len(components)-1] == "*"
+	last := components[len(components)-1]
+	return len(last) > 0 && last[0] == '*'
 }
 
-// For now, this function will just drop the wildcard (*) character.
+// Gets the name of the parameter that the remainder of the path should be
+// captured under, if the path ends with a named wildcard, such as `/*filepath`.
+func wildcardName(path string) string {
+	if !pathHasWildcard(path) {
+		return ""
+	}
+	return path[strings.LastIndex(path, "/")+2:]
+}
+
+// For now, this function will just drop the wildcard (*) character, along with
+// its name, if any.
 func extractRelevantPath(path string) string {
 	if pathHasWildcard(path) {
-		// Remove the top two characters. First the *, then the /.
+		// Remove everything starting from the last slash.
 		//
-		// For instance, /foo/bar/* will now become /foo/bar
-		return path[:len(path)-2]
+		// For instance, /foo/bar/* and /foo/bar/*name will now become /foo/bar
+		return path[:strings.LastIndex(path, "/")]
 	}
 	return path
 }
 
-func (m *Muxer) addHandlerMethod(path string, method string, h http.Handler) {
-	// TODO: don't only check for `RouteHandler`s. Sometimes, we want the
-	// catch-all types.
+// Splits the request path into its components. An empty path, which is what a
+// request for an absolute URL without a path, such as `GET http://example.com`,
+// ends up with, is the same as the root.
+func splitPath(p string) []string {
+	if len(p) <= 0 {
+		return []string{""}
+	}
+	return strings.Split(p[1:], "/")
+}
 
-	nonWildcardPath := extractRelevantPath(path)
+// Gets the components of the path, without the wildcard. A wildcard at the very
+// root has no components at all.
+func routeComponents(path string) []string {
+	pathNoWildcard := extractRelevantPath(path)
+	if len(pathNoWildcard) <= 0 {
+		return []string{}
+	}
 
-	handler, ok := m.routes.get(nonWildcardPath).(*routeHandler)
-	h = m.wrapHandler(path, h)
-	if handler == nil || !ok {
-		m.routes.add(nonWildcardPath, &routeHandler{method: h})
-	} else {
-		(*handler)[method] = h
+	// The first slash is a distraction.
+	return strings.Split(pathNoWildcard[1:], "/")
+}
+
+// Checks that the route pattern is something that can be added to the routes
+// tree at all.
+func validatePath(path string) error {
+	if len(path) <= 0 {
+		return errors.New("route cannot be empty")
+	}
+	if path[0] != '/' {
+		return fmt.Errorf("route %s must begin with a slash", path)
+	}
+	components := strings.Split(path, "/")
+	for i, component := range components {
+		if strings.HasPrefix(component, "*") && i < len(components)-1 {
+			return fmt.Errorf(
+				"wildcard %s of route %s must be the last component",
+				component,
+				path,
+			)
+		}
+		if !balancedBraces(component) {
+			return fmt.Errorf("route %s has unbalanced braces", path)
+		}
+		for _, part := range parseSegment(component) {
+			if part.param && len(part.name) <= 0 {
+				return fmt.Errorf("route %s has a parameter without a name", path)
+			}
+		}
+	}
+	return nil
+}
+
+// Determines whether every brace in the path component is closed, and no brace
+// is closed without having been opened.
+func balancedBraces(component string) bool {
+	depth := 0
+	for i := 0; i < len(component); i++ {
+		switch component[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
 	}
+	return depth == 0
+}
+
+func (m *Muxer) addHandlerMethod(
+	table *routeTable,
+	path string,
+	method string,
+	h http.Handler,
+	mw []func(http.Handler) http.Handler,
+) error {
+	return m.addMatchedHandlerMethod(table, path, method, nil, h, mw)
 }
 
-func (m *Muxer) addCatchAllHandler(path string, h http.Handler) {
-	nonWildcardPath := extractRelevantPath(path)
+func (m *Muxer) addMatchedHandlerMethod(
+	table *routeTable,
+	path string,
+	method string,
+	matchers []Matcher,
+	h http.Handler,
+	mw []func(http.Handler) http.Handler,
+) error {
+	if err := validatePath(path); err != nil {
+		return err
+	}
+
+	expansions, err := expandOptional(path)
+	if err != nil {
+		return err
+	}
+	wrapped, err := m.wrapExpansions(path, expansions, h, mw)
+	if err != nil {
+		return err
+	}
+	for i := range wrapped {
+		wrapped[i].matchers = matchers
+	}
 
-	m.routes.add(nonWildcardPath, m.wrapHandler(path, h))
+	return table.update(func(tree *routes) error {
+		for i, expansion := range expansions {
+			err := addToRouteHandler(
+				tree,
+				extractRelevantPath(expansion),
+				path,
+				method,
+				wrapped[i],
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Wraps the handler once for every expansion of the route pattern. The
+// middlewares are only applied once, and shared between the expansions.
+func (m *Muxer) wrapExpansions(
+	pattern string,
+	expansions []string,
+	h http.Handler,
+	mw []func(http.Handler) http.Handler,
+) ([]wrappedHandler, error) {
+	wrapped := m.wrapHandler(pattern, h, mw)
+	handlers := make([]wrappedHandler, len(expansions))
+	for i, expansion := range expansions {
+		captures, err := compileCaptures(expansion)
+		if err != nil {
+			return nil, err
+		}
+		handlers[i] = wrapped
+		handlers[i].path = expansion
+		handlers[i].captures = captures
+		handlers[i].alias = i > 0
+	}
+	return handlers, nil
+}
+
+// Adds the handler to the route handler under the path in the routes tree. The
+// route handler is copied, rather than changed, since it may still be in use by
+// an older tree.
+func addToRouteHandler(
+	tree *routes,
+	nonWildcardPath string,
+	path string,
+	method string,
+	wrapped wrappedHandler,
+) error {
+	handler := &routeHandler{}
+	if existing, ok := tree.find(nonWildcardPath).(*routeHandler); ok {
+		handler = existing.clone()
+
+		// Handlers with matchers never conflict, since there is no telling
+		// whether their matchers overlap.
+		previous, ok := handler.unconditional(method)
+		if ok && len(wrapped.matchers) <= 0 {
+			reason := "a " + method + " handler has already been added"
+			if method == anyMethod {
+				reason = "a handler for all methods has already been added"
+			}
+			return &ConflictError{
+				Route:    path,
+				Existing: previous.pattern,
+				Reason:   reason,
+			}
+		}
+	}
+
+	// Adding the copy replaces the original route handler, and it gives the
+	// routes tree the chance to check the parameter constraints.
+	handler.add(method, wrapped)
+	return tree.add(nonWildcardPath, handler)
+}
+
+func (m *Muxer) addCatchAllHandler(
+	table *routeTable,
+	path string,
+	h http.Handler,
+	mw []func(http.Handler) http.Handler,
+) error {
+	return m.addMatchedHandlerMethod(table, path, anyMethod, nil, h, mw)
 }
 
 // AddGetHandler adds an http.Handler associated with a GET request to the
 // specified route.
-func (m *Muxer) AddGetHandler(route string, h http.Handler) {
-	m.addHandlerMethod(route, "GET", h)
+func (m *Muxer) AddGetHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.addHandlerMethod(m.routes, route, "GET", h, mw)
 }
 
 // AddGetHandlerFunc adds a GET http.HandlerFunc associated with a GET request
 // to the specified route.
-func (m *Muxer) AddGetHandlerFunc(route string, h http.HandlerFunc) {
-	m.AddGetHandler(route, http.HandlerFunc(h))
+func (m *Muxer) AddGetHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.AddGetHandler(route, http.HandlerFunc(h), mw...)
 }
 
 // AddPostHandler adds an http.Handler associated with a POST request to the
 // specified route.
-func (m *Muxer) AddPostHandler(route string, h http.Handler) {
-	m.addHandlerMethod(route, "POST", h)
+func (m *Muxer) AddPostHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.addHandlerMethod(m.routes, route, "POST", h, mw)
 }
 
 // AddPostHandlerFunc adds a POST http.HandlerFunc associated with a POST
 // request to the specified route.
-func (m *Muxer) AddPostHandlerFunc(route string, h http.HandlerFunc) {
-	m.AddPostHandler(route, http.HandlerFunc(h))
+func (m *Muxer) AddPostHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.AddPostHandler(route, http.HandlerFunc(h), mw...)
 }
 
 // AddPutHandler adds an http.Handler associated with a PUT request to the
 // specified route.
-func (m *Muxer) AddPutHandler(route string, h http.Handler) {
-	m.addHandlerMethod(route, "PUT", h)
+func (m *Muxer) AddPutHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.addHandlerMethod(m.routes, route, "PUT", h, mw)
 }
 
 // AddPutHandlerFunc adds an http.HandlerFUnc associated with a PUT request to
 // the specified route.
-func (m *Muxer) AddPutHandlerFunc(route string, h http.HandlerFunc) {
-	m.AddPutHandler(route, h)
+func (m *Muxer) AddPutHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.AddPutHandler(route, h, mw...)
 }
 
 // AddDeleteHandler adds an http.Handler associated with a DELETE request to the
 // specified route.
-func (m *Muxer) AddDeleteHandler(route string, h http.Handler) {
-	m.addHandlerMethod(route, "DELETE", h)
+func (m *Muxer) AddDeleteHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.addHandlerMethod(m.routes, route, "DELETE", h, mw)
 }
 
 // AddDeleteHandlerFunc adds an http.HandlerFunc associated with a DELETE
 // request to the specified route.
-func (m *Muxer) AddDeleteHandlerFunc(route string, h http.HandlerFunc) {
-	m.AddDeleteHandler(route, http.HandlerFunc(h))
+func (m *Muxer) AddDeleteHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.AddDeleteHandler(route, http.HandlerFunc(h), mw...)
 }
 
 // AddPatchHandler adds an http.Handler associated with a PATCH request to the
 // specified route.
-func (m *Muxer) AddPatchHandler(route string, h http.Handler) {
-	m.addHandlerMethod(route, "PATCH", h)
+func (m *Muxer) AddPatchHandler(
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.addHandlerMethod(m.routes, route, "PATCH", h, mw)
 }
 
 // AddPatchHandlerFunc adds an http.Handler associated with a PATCH request to
 // the specified route.
-func (m *Muxer) AddPatchHandlerFunc(route string, h http.HandlerFunc) {
-	m.AddPatchHandler(route, http.HandlerFunc(h))
+func (m *Muxer) AddPatchHandlerFunc(
+	route string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.AddPatchHandler(route, http.HandlerFunc(h), mw...)
 }
 
 // AddCustomMethodHandler adds an http.Handler associated with a custom method
 // to the specified route.
-func (m *Muxer) AddCustomMethodHandler(method, route string, h http.Handler) {
-	m.addHandlerMethod(route, method, h)
+func (m *Muxer) AddCustomMethodHandler(
+	method,
+	route string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.addHandlerMethod(m.routes, route, method, h, mw)
 }
 
 // AddCustomMethodHandlerFunc adds a http.HandlerFunc associated with a custom
@@ -225,20 +785,58 @@ func (m *Muxer) AddCustomMethodHandlerFunc(
 	method,
 	route string,
 	h http.HandlerFunc,
-) {
-	m.AddCustomMethodHandler(route, method, http.HandlerFunc(h))
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.AddCustomMethodHandler(method, route, http.HandlerFunc(h), mw...)
+}
+
+// AddMatchedHandler adds an http.Handler associated with the method to the
+// specified route, which is only called for the requests that satisfy every
+// one of the matchers. Several handlers with matchers can be added to the same
+// route and method. They are tried in the order in which they were added,
+// before the handler without any matchers, if any.
+func (m *Muxer) AddMatchedHandler(
+	method,
+	route string,
+	matchers []Matcher,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.addMatchedHandlerMethod(m.routes, route, method, matchers, h, mw)
+}
+
+// AddMatchedHandlerFunc adds an http.HandlerFunc associated with the method to
+// the specified route, which is only called for the requests that satisfy
+// every one of the matchers.
+func (m *Muxer) AddMatchedHandlerFunc(
+	method,
+	route string,
+	matchers []Matcher,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.AddMatchedHandler(method, route, matchers, h, mw...)
 }
 
 // AddHandler adds a http.Handler associated with any HTTP method request to the
-// specified route.
-func (m *Muxer) AddHandler(path string, h http.Handler) {
-	m.addCatchAllHandler(path, h)
+// specified route. Handlers that are added to the same route for specific
+// methods take precedence, and this one handles every other method.
+func (m *Muxer) AddHandler(
+	path string,
+	h http.Handler,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.addCatchAllHandler(m.routes, path, h, mw)
 }
 
 // AddHandlerFunc adds a http.HandlerFunc associated with any HTTP method
 // request to the specified route.
-func (m *Muxer) AddHandlerFunc(path string, h http.HandlerFunc) {
-	m.AddHandler(path, http.HandlerFunc(h))
+func (m *Muxer) AddHandlerFunc(
+	path string,
+	h http.HandlerFunc,
+	mw ...func(http.Handler) http.Handler,
+) error {
+	return m.AddHandler(path, http.HandlerFunc(h), mw...)
 }
 
 // SetNotFoundHandler sets the not found handler.
@@ -246,49 +844,117 @@ func (m *Muxer) SetNotFoundHandler(h http.Handler) {
 	m.notFoundHandler = h
 }
 
-// ServeHTTP is the entry-point for the entire muxer's HTTP request.
-func (m Muxer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	// We want to strip the prefix. But under what logic?
-	//
-	// No matter how nested this instance is, we will typically get the full URL
-	// path.
-	//
-	// And so, grab offset context variable, to strip out the prefix.
-	offset, ok := req.Context().Value(pathOffsetContextKey).(int)
-	if !ok {
-		offset = 0
+// SetAutoHead sets whether HEAD requests to a route that only has a GET
+// handler should be served by that GET handler, with the response body
+// discarded. It is enabled by default.
+func (m *Muxer) SetAutoHead(enabled bool) {
+	m.disableAutoHead = !enabled
+}
+
+// SetAutoOptions sets whether OPTIONS requests to a route that has no OPTIONS
+// handler should be answered with an empty response, whose Allow header lists
+// the methods registered to the route. It is enabled by default.
+func (m *Muxer) SetAutoOptions(enabled bool) {
+	m.disableAutoOptions = !enabled
+}
+
+// Gets the methods that are allowed for the path, by any of the routes that
+// accept it, including the ones that the host falls back to. This includes the
+// methods that the muxer handles on its own.
+func (m *Muxer) allowedMethods(host *hostRoutes, path string) []string {
+	trees := []*routes{}
+	if host != nil {
+		trees = append(trees, host.routes.load())
+	}
+	if host == nil || host.fallback {
+		trees = append(trees, m.routes.load())
 	}
 
-	// Extract the relevant part of the path.
-	pathComponents := strings.Split(req.URL.Path[1:], "/")[offset:]
-	partialPath := "/" + strings.Join(pathComponents, "/")
+	// Every route that the lookup could have backtracked to serves the path for
+	// its own methods.
+	allowed := []string{}
+	for _, tree := range trees {
+		tree.candidates(
+			path,
+			matchMode{
+				foldCase: m.casePolicy != CaseSensitive,
+				unescape: m.useRawPath,
+			},
+			func(value interface{}, remainder string) {
+				handler, ok := value.(*routeHandler)
+				if !ok || handler == nil {
+					return
+				}
+				for _, method := range handler.allowedMethods(remainder) {
+					if !contains(allowed, method) {
+						allowed = append(allowed, method)
+					}
+				}
+			},
+		)
+	}
+	if len(allowed) <= 0 {
+		return allowed
+	}
+	if !m.disableAutoHead && contains(allowed, http.MethodGet) &&
+		!contains(allowed, http.MethodHead) {
+		allowed = append(allowed, http.MethodHead)
+	}
+	if !m.disableAutoOptions && !contains(allowed, http.MethodOptions) {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
 
-	result := m.routes.getShortCircuited(partialPath)
+// Determines whether the list of strings contains the given value.
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
 
-	if !result.retrieved {
-		m.notFoundHandler.ServeHTTP(w, req)
+// SetMethodNotAllowedHandler sets the handler that is called when the request
+// path matches a route, but no handler was registered for the request's
+// method. By the time the handler is called, the Allow header will have
+// already been set.
+func (m *Muxer) SetMethodNotAllowedHandler(h http.Handler) {
+	m.methodNotAllowedHandler = h
+}
+
+// Use adds middlewares that will wrap every request that the muxer
+// dispatches, including requests that end up at the not found handler.
+//
+// Middlewares that should only wrap a single route can instead be supplied as
+// the trailing arguments of any of the Add*Handler methods.
+//
+// Middlewares run in the order in which they were added, and they run before
+// any middleware that was supplied alongside a specific route. When a muxer is
+// mounted inside another muxer, the outer muxer's middlewares run first.
+//
+// Every middleware is called once, right away, to wrap the muxer.
+func (m *Muxer) Use(mw ...func(http.Handler) http.Handler) {
+	if len(mw) <= 0 {
 		return
 	}
+	tail := &middlewareTail{wrapperServer{*m}}
+	h := newMiddlewareList(mw).wrap(tail)
+	if m.tail == nil {
+		m.handler = h
+	} else {
+		m.tail.next = h
+	}
+	m.tail = tail
+}
 
-	switch handler := result.value.(type) {
-	case *routeHandler:
-		if handler == nil {
-			m.notFoundHandler.ServeHTTP(w, req)
-		} else {
-			h, ok := (*handler)[req.Method]
-			if !ok {
-				m.notFoundHandler.ServeHTTP(w, req)
-			} else {
-				h.ServeHTTP(w, req)
-			}
-		}
-	case http.Handler:
-		if handler == nil {
-			m.notFoundHandler.ServeHTTP(w, req)
-		} else {
-			handler.ServeHTTP(w, req)
-		}
-	default:
-		m.notFoundHandler.ServeHTTP(w, req)
+// ServeHTTP is the entry-point for the entire muxer's HTTP request.
+func (m Muxer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if m.handler == nil {
+		wrapperServer{m}.ServeHTTP(w, req)
+		return
 	}
+	m.handler.ServeHTTP(w, req)
 }
@@ -1,8 +1,11 @@
 package muxer
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -375,12 +378,15 @@ func TestNonWildcard(t *testing.T) {
 }
 
 func TestMethodNoExist(t *testing.T) {
-	expected := "Not found"
+	expected := "Method not allowed"
 
 	muxer := NewMuxer()
 	muxer.AddGetHandler("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Haha"))
 	}))
+	muxer.AddPutHandler("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Haha"))
+	}))
 
 	req, err := http.NewRequest("POST", "/foo", nil)
 	if err != nil {
@@ -390,19 +396,91 @@ func TestMethodNoExist(t *testing.T) {
 	rr := httptest.NewRecorder()
 	muxer.ServeHTTP(rr, req)
 
-	if status := rr.Result().StatusCode; status != http.StatusNotFound {
+	if status := rr.Result().StatusCode; status != http.StatusMethodNotAllowed {
 		t.Errorf(
 			"Status code is not what is expected: want %d, but got %d",
-			http.StatusNotFound,
+			http.StatusMethodNotAllowed,
+			status,
+		)
+	}
+
+	if allow := rr.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, PUT" {
+		t.Errorf(
+			"Allow header is unexpected: want %v, but got %v",
+			"GET, HEAD, OPTIONS, PUT",
+			allow,
+		)
+	}
+
+	if body := rr.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+	}
+}
+
+func TestSetMethodNotAllowedHandler(t *testing.T) {
+	expected := "Nope"
+
+	muxer := NewMuxer()
+	muxer.AddGetHandler("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Haha"))
+	}))
+	muxer.SetMethodNotAllowedHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(expected))
+	}))
+
+	req, err := http.NewRequest("POST", "/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Result().StatusCode; status != http.StatusTeapot {
+		t.Errorf(
+			"Status code is not what is expected: want %d, but got %d",
+			http.StatusTeapot,
 			status,
 		)
 	}
 
+	if allow := rr.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf(
+			"Allow header is unexpected: want %v, but got %v",
+			"GET, HEAD, OPTIONS",
+			allow,
+		)
+	}
+
 	if body := rr.Body.String(); body != expected {
 		t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
 	}
 }
 
+func TestMethodNoExistNonWildcard(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandler("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Haha"))
+	}))
+
+	req, err := http.NewRequest("POST", "/foo/bar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Result().StatusCode; status != http.StatusNotFound {
+		t.Errorf(
+			"Status code is not what is expected: want %d, but got %d",
+			http.StatusNotFound,
+			status,
+		)
+	}
+}
+
 func TestSubMuxerAndWildcard(t *testing.T) {
 	expected := "haha"
 
@@ -535,3 +613,2033 @@ func TestSubMuxerWithRouterNestedRoute(t *testing.T) {
 		t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
 	}
 }
+
+// Middleware that appends the supplied name to the response body, before
+// handing the request over to the next handler.
+func tagMiddleware(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	expected := "abch"
+
+	muxer := NewMuxer()
+	muxer.Use(tagMiddleware("a"), tagMiddleware("b"))
+	muxer.AddGetHandlerFunc(
+		"/foo",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("h"))
+		},
+		tagMiddleware("c"),
+	)
+
+	req, err := http.NewRequest("GET", "/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if body := rr.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+	}
+}
+
+func TestUseConstructsMiddlewaresOnce(t *testing.T) {
+	constructed := 0
+	counting := func(tag string) func(http.Handler) http.Handler {
+		mw := tagMiddleware(tag)
+		return func(next http.Handler) http.Handler {
+			constructed++
+			return mw(next)
+		}
+	}
+
+	muxer := NewMuxer()
+	muxer.Use(counting("a"))
+	muxer.Use(counting("b"), counting("c"))
+	muxer.AddGetHandlerFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("h"))
+	})
+
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest("GET", "/foo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != "abch" {
+			t.Errorf("handler returned unexpected: want %v, but got %v", "abch", body)
+		}
+	}
+
+	if constructed != 3 {
+		t.Errorf("Expected every middleware to be constructed once, but got %d constructions", constructed)
+	}
+}
+
+func TestUseOnCopiedMuxer(t *testing.T) {
+	build := func() Muxer {
+		m := NewMuxer()
+		m.Use(tagMiddleware("a"))
+		return m
+	}
+
+	muxer := build()
+	muxer.SetNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("missing"))
+	}))
+	muxer.SetTrailingSlashPolicy(TrailingSlashIgnore)
+	muxer.Host("api.example.com", func(g *Group) {
+		g.AddGetHandlerFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("api"))
+		})
+	})
+
+	for _, test := range []struct {
+		host     string
+		path     string
+		expected string
+	}{
+		{"api.example.com", "/status", "aapi"},
+		{"api.example.com", "/status/", "aapi"},
+		{"example.com", "/status", "amissing"},
+	} {
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = test.host
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+}
+
+func TestUseNotFound(t *testing.T) {
+	expected := "aNot found"
+
+	muxer := NewMuxer()
+	muxer.Use(tagMiddleware("a"))
+	muxer.AddGetHandlerFunc(
+		"/foo",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("h"))
+		},
+		tagMiddleware("c"),
+	)
+
+	req, err := http.NewRequest("GET", "/bar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if body := rr.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+	}
+}
+
+func TestUseSubMuxer(t *testing.T) {
+	expected := "abcdh"
+
+	muxer := NewMuxer()
+	subMuxer := NewMuxer()
+
+	muxer.Use(tagMiddleware("a"))
+	subMuxer.Use(tagMiddleware("c"))
+	subMuxer.AddGetHandlerFunc(
+		"/bar",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("h"))
+		},
+		tagMiddleware("d"),
+	)
+	muxer.AddHandler("/foo/*", subMuxer, tagMiddleware("b"))
+
+	req, err := http.NewRequest("GET", "/foo/bar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if body := rr.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+	}
+}
+
+func TestAutoHead(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandler("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Foo", "bar")
+		w.Write([]byte("Haha"))
+	}))
+
+	req, err := http.NewRequest("HEAD", "/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Result().StatusCode; status != http.StatusOK {
+		t.Errorf(
+			"Status code is not what is expected: want %d, but got %d",
+			http.StatusOK,
+			status,
+		)
+	}
+
+	if header := rr.Header().Get("X-Foo"); header != "bar" {
+		t.Errorf("X-Foo header is unexpected: want %v, but got %v", "bar", header)
+	}
+
+	if body := rr.Body.String(); body != "" {
+		t.Errorf("handler returned unexpected: want empty body, but got %v", body)
+	}
+}
+
+func TestAutoHeadDisabled(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.SetAutoHead(false)
+	muxer.AddGetHandler("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Haha"))
+	}))
+
+	req, err := http.NewRequest("HEAD", "/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Result().StatusCode; status != http.StatusMethodNotAllowed {
+		t.Errorf(
+			"Status code is not what is expected: want %d, but got %d",
+			http.StatusMethodNotAllowed,
+			status,
+		)
+	}
+
+	if allow := rr.Header().Get("Allow"); allow != "GET, OPTIONS" {
+		t.Errorf(
+			"Allow header is unexpected: want %v, but got %v",
+			"GET, OPTIONS",
+			allow,
+		)
+	}
+}
+
+func TestAutoOptions(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandler("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Haha"))
+	}))
+	muxer.AddPostHandler("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Haha"))
+	}))
+
+	req, err := http.NewRequest("OPTIONS", "/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Result().StatusCode; status != http.StatusNoContent {
+		t.Errorf(
+			"Status code is not what is expected: want %d, but got %d",
+			http.StatusNoContent,
+			status,
+		)
+	}
+
+	if allow := rr.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+		t.Errorf(
+			"Allow header is unexpected: want %v, but got %v",
+			"GET, HEAD, OPTIONS, POST",
+			allow,
+		)
+	}
+}
+
+func TestAutoOptionsDisabled(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.SetAutoOptions(false)
+	muxer.AddGetHandler("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Haha"))
+	}))
+
+	req, err := http.NewRequest("OPTIONS", "/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Result().StatusCode; status != http.StatusMethodNotAllowed {
+		t.Errorf(
+			"Status code is not what is expected: want %d, but got %d",
+			http.StatusMethodNotAllowed,
+			status,
+		)
+	}
+}
+
+func TestStaticAndParamSiblings(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc(
+		"/users/:id",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(Params(r)["id"]))
+		},
+	)
+	muxer.AddGetHandlerFunc(
+		"/users/me",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("me"))
+		},
+	)
+
+	for path, expected := range map[string]string{
+		"/users/42": "42",
+		"/users/me": "me",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+		}
+	}
+}
+
+func TestDuplicateMethodConflict(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	if err := muxer.AddGetHandlerFunc("/foo/:id", noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.AddPostHandlerFunc("/foo/:id", noop); err != nil {
+		t.Fatal(err)
+	}
+
+	err := muxer.AddGetHandlerFunc("/foo/:id", noop)
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("Expected a conflict error, but got %v", err)
+	}
+	if conflict.Existing != "/foo/:id" {
+		t.Errorf("Expected the existing route to be /foo/:id, but got %s", conflict.Existing)
+	}
+}
+
+func TestCatchAllConflict(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	if err := muxer.AddHandlerFunc("/bar/*", noop); err != nil {
+		t.Fatal(err)
+	}
+	err := muxer.AddHandlerFunc("/bar", noop)
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("Expected a conflict error, but got %v", err)
+	}
+	if conflict.Existing != "/bar/*" {
+		t.Errorf("Expected the existing route to be /bar/*, but got %s", conflict.Existing)
+	}
+}
+
+func TestCatchAllAlongsideMethods(t *testing.T) {
+	muxer := NewMuxer()
+	write := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}
+	}
+	if err := muxer.AddGetHandlerFunc("/api/status", write("status")); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.AddHandlerFunc("/api/status", write("proxy")); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.AddPostHandlerFunc("/api", write("native")); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.Mount("/api", write("proxy")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/api/status", "status"},
+		{"DELETE", "/api/status", "proxy"},
+		{"HEAD", "/api/status", "proxy"},
+		{"POST", "/api", "native"},
+		{"GET", "/api", "proxy"},
+		{"POST", "/api/users", "proxy"},
+	} {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+
+	if err := muxer.RemoveAll("/api/*"); err != nil {
+		t.Error(err)
+	}
+	req, err := http.NewRequest("GET", "/api", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusMethodNotAllowed {
+		t.Errorf("handler returned unexpected: want %v, but got %v", http.StatusMethodNotAllowed, status)
+	}
+}
+
+func TestCatchAllBelowMethodRoute(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddHandlerFunc("/p/*rest", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxy " + Params(r)["rest"]))
+	})
+	muxer.AddGetHandlerFunc("/p/native", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("native"))
+	})
+
+	for _, test := range []struct {
+		method   string
+		expected string
+	}{
+		{"GET", "native"},
+		{"POST", "proxy native"},
+		{"DELETE", "proxy native"},
+	} {
+		req, err := http.NewRequest(test.method, "/p/native", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned unexpected: want %v, but got %v", http.StatusOK, status)
+		}
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+}
+
+func TestParamNameAliases(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc("/users/:id/posts", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r))))
+	})
+	muxer.AddGetHandlerFunc("/users/:userID/settings", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r))))
+	})
+	muxer.AddGetHandlerFunc("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r))))
+	})
+	muxer.AddPostHandlerFunc("/users/:name", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r))))
+	})
+	muxer.Mount("/orgs/:org", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r))))
+	}))
+	muxer.AddGetHandlerFunc("/orgs/:slug/members", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r))))
+	})
+
+	for _, test := range []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/users/42/posts", "map[id:42]"},
+		{"GET", "/users/42/settings", "map[userID:42]"},
+		{"GET", "/users/42", "map[id:42]"},
+		{"POST", "/users/42", "map[name:42]"},
+		{"GET", "/orgs/acme/members", "map[slug:acme]"},
+		{"GET", "/orgs/acme/repos", "map[org:acme]"},
+	} {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	if err := muxer.AddGetHandlerFunc("/users/:userID", noop); err == nil {
+		t.Error("Expected a second GET handler for the same route to conflict")
+	}
+}
+
+func TestInvalidRoute(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	if err := muxer.AddGetHandlerFunc("", noop); err == nil {
+		t.Error("Expected an empty route to be rejected")
+	}
+	if err := muxer.AddGetHandlerFunc("foo", noop); err == nil {
+		t.Error("Expected a route without a leading slash to be rejected")
+	}
+	for _, route := range []string{"/z/:", "/z/:/x", "/z/:{int}", "/z/v:", "/z/:name.:"} {
+		if err := muxer.AddGetHandlerFunc(route, noop); err == nil {
+			t.Errorf("Expected route %s with an unnamed parameter to be rejected", route)
+		}
+	}
+	for _, route := range []string{"/a/*/b", "/*name/x", "/a/*rest/"} {
+		if err := muxer.AddGetHandlerFunc(route, noop); err == nil {
+			t.Errorf("Expected route %s with a wildcard before its end to be rejected", route)
+		}
+	}
+	for _, route := range []string{"/:id{", "/{", "/:id}", "/:id{int}}", "/:id{[a-z]{2}"} {
+		if err := muxer.AddGetHandlerFunc(route, noop); err == nil {
+			t.Errorf("Expected route %s with unbalanced braces to be rejected", route)
+		}
+	}
+	if routes := muxer.Routes(); len(routes) > 0 {
+		t.Errorf("Expected no routes to be added, but got %v", routes)
+	}
+}
+
+func TestURL(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	if err := muxer.AddGetHandlerFunc("/users/:id/posts/:post", noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.Name("user.post", "/users/:id/posts/:post"); err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := muxer.URL("user.post", "id", "42", "post", "hello world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/users/42/posts/hello%20world"; url != expected {
+		t.Errorf("URL is unexpected: want %v, but got %v", expected, url)
+	}
+
+	if _, err := muxer.URL("user.post", "id", "42"); err == nil {
+		t.Error("Expected an error for the missing parameter")
+	}
+	if _, err := muxer.URL("user.post", "id", "42", "post", "1", "extra", "2"); err == nil {
+		t.Error("Expected an error for the extra parameter")
+	}
+	if _, err := muxer.URL("user.nothing"); err == nil {
+		t.Error("Expected an error for the unknown name")
+	}
+}
+
+func TestURLWildcard(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	if err := muxer.AddHandlerFunc("/static/*", noop); err != nil {
+		t.Fatal(err)
+	}
+	if err := muxer.Name("static", "/static/*"); err != nil {
+		t.Fatal(err)
+	}
+
+	url, err := muxer.URL("static", "*", "css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/static/css/main.css"; url != expected {
+		t.Errorf("URL is unexpected: want %v, but got %v", expected, url)
+	}
+}
+
+func TestNameUnknownRoute(t *testing.T) {
+	muxer := NewMuxer()
+
+	if err := muxer.Name("user.show", "/users/:id"); err == nil {
+		t.Error("Expected an error for naming a route that was never added")
+	}
+
+	muxer.AddGetHandlerFunc("/users/:id", func(w http.ResponseWriter, r *http.Request) {})
+	if err := muxer.Name("user.show", "/users/:uid"); err == nil {
+		t.Error("Expected an error for naming a route that was added under another spelling")
+	}
+	if err := muxer.Name("user.show", "/users/:id"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	muxer := NewMuxer()
+	subMuxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	muxer.AddGetHandlerFunc("/users/:id", noop)
+	muxer.AddPutHandlerFunc("/users/:id", noop)
+	muxer.AddPostHandlerFunc("/users", noop)
+	muxer.AddHandlerFunc("/static/*", noop)
+	subMuxer.AddGetHandlerFunc("/", noop)
+	subMuxer.AddDeleteHandlerFunc("/items/:item", noop)
+	muxer.AddHandler("/api/*", subMuxer)
+
+	expected := []Route{
+		{Pattern: "/api", Methods: []string{"GET"}},
+		{Pattern: "/api/items/:item", Methods: []string{"DELETE"}},
+		{Pattern: "/static/*"},
+		{Pattern: "/users", Methods: []string{"POST"}},
+		{Pattern: "/users/:id", Methods: []string{"GET", "PUT"}},
+	}
+
+	routes := muxer.Routes()
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Routes are unexpected: want %v, but got %v", expected, routes)
+	}
+}
+
+func TestMuxerWithConstrainedParams(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc(
+		"/orders/:id{uuid}",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("uuid " + Params(r)["id"]))
+		},
+	)
+	muxer.AddGetHandlerFunc(
+		"/orders/:id{int}",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("int " + Params(r)["id"]))
+		},
+	)
+
+	for path, expected := range map[string]string{
+		"/orders/42": "int 42",
+		"/orders/123e4567-e89b-12d3-a456-426614174000": "uuid 123e4567-e89b-12d3-a456-426614174000",
+		"/orders/foo": "Not found",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+		}
+	}
+}
+
+func TestURLConstraint(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	muxer.AddGetHandlerFunc("/users/:id{int}", noop)
+	muxer.Name("user.show", "/users/:id{int}")
+
+	url, err := muxer.URL("user.show", "id", "42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/users/42"; url != expected {
+		t.Errorf("URL is unexpected: want %v, but got %v", expected, url)
+	}
+
+	if _, err := muxer.URL("user.show", "id", "me"); err == nil {
+		t.Error("Expected an error for the value that fails the constraint")
+	}
+}
+
+func TestNamedWildcard(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc(
+		"/static/*filepath",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(Params(r)["filepath"]))
+		},
+	)
+
+	for path, expected := range map[string]string{
+		"/static/css/main.css":  "css/main.css",
+		"/static/my%20file.txt": "my file.txt",
+		"/static":               "",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if status := rr.Result().StatusCode; status != http.StatusOK {
+			t.Errorf(
+				"Status code is not what is expected: want %d, but got %d",
+				http.StatusOK,
+				status,
+			)
+		}
+
+		if body := rr.Body.String(); body != expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+		}
+	}
+}
+
+func TestRootWildcard(t *testing.T) {
+	expected := "foo/bar"
+
+	muxer := NewMuxer()
+	muxer.AddHandlerFunc(
+		"/*path",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(Params(r)["path"]))
+		},
+	)
+
+	req, err := http.NewRequest("GET", "/foo/bar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if body := rr.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+	}
+}
+
+func TestURLNamedWildcard(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	muxer.AddGetHandlerFunc("/static/*filepath", noop)
+	muxer.Name("static", "/static/*filepath")
+
+	url, err := muxer.URL("static", "filepath", "css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/static/css/main.css"; url != expected {
+		t.Errorf("URL is unexpected: want %v, but got %v", expected, url)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.Use(tagMiddleware("a"))
+	muxer.Group("/api", func(g *Group) {
+		g.Use(tagMiddleware("b"))
+		g.AddGetHandlerFunc(
+			"/users/:id",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(Params(r)["id"]))
+			},
+			tagMiddleware("c"),
+		)
+		g.Group("/v1", func(g *Group) {
+			g.Use(tagMiddleware("d"))
+			g.AddGetHandlerFunc(
+				"/",
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Write([]byte("v1"))
+				},
+			)
+		})
+		g.AddGetHandlerFunc(
+			"/",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("api"))
+			},
+		)
+	})
+
+	for path, expected := range map[string]string{
+		"/api/users/42": "abc42",
+		"/api/v1":       "abdv1",
+		"/api":          "abapi",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+		}
+	}
+
+	expected := []Route{
+		{Pattern: "/api", Methods: []string{"GET"}},
+		{Pattern: "/api/users/:id", Methods: []string{"GET"}},
+		{Pattern: "/api/v1", Methods: []string{"GET"}},
+	}
+	if routes := muxer.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Routes are unexpected: want %v, but got %v", expected, routes)
+	}
+}
+
+func TestMount(t *testing.T) {
+	muxer := NewMuxer()
+	subMuxer := NewMuxer()
+
+	subMuxer.AddGetHandlerFunc(
+		"/posts/:post",
+		func(w http.ResponseWriter, r *http.Request) {
+			params := Params(r)
+			w.Write([]byte(r.URL.Path + " " + params["user"] + " " + params["post"]))
+		},
+	)
+	muxer.Mount("/users/:user", subMuxer)
+	muxer.Mount("/files", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + r.URL.RawPath))
+	}))
+
+	for path, expected := range map[string]string{
+		"/users/42/posts/7":    "/posts/7 42 7",
+		"/files/a%2Fb/c":       "/a/b/c /a%2Fb/c",
+		"/files/some/file.txt": "/some/file.txt ",
+		"/files":               "/ ",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+		}
+	}
+}
+
+func TestNestedMount(t *testing.T) {
+	expected := "/baz"
+
+	muxer := NewMuxer()
+	middleMuxer := NewMuxer()
+	innerMuxer := NewMuxer()
+
+	innerMuxer.AddGetHandlerFunc(
+		"/baz",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.URL.Path))
+		},
+	)
+	middleMuxer.Mount("/bar", innerMuxer)
+
+	// A handler that isn't a muxer sits between the two muxers.
+	muxer.Mount("/foo", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleMuxer.ServeHTTP(w, r)
+	}))
+
+	req, err := http.NewRequest("GET", "/foo/bar/baz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if body := rr.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+	}
+}
+
+func TestTrailingSlashStrict(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+	})
+
+	req, err := http.NewRequest("GET", "/foo/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Result().StatusCode; status != http.StatusNotFound {
+		t.Errorf(
+			"Status code is not what is expected: want %d, but got %d",
+			http.StatusNotFound,
+			status,
+		)
+	}
+}
+
+func TestTrailingSlashIgnore(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.SetTrailingSlashPolicy(TrailingSlashIgnore)
+	muxer.AddGetHandlerFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+	})
+	muxer.AddGetHandlerFunc("/bar/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("bar"))
+	})
+
+	for path, expected := range map[string]string{
+		"/foo/": "foo",
+		"/bar":  "bar",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+		}
+	}
+}
+
+func TestTrailingSlashIgnoreSubMuxer(t *testing.T) {
+	sub := NewMuxer()
+	sub.AddGetHandlerFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("sub"))
+	})
+
+	muxer := NewMuxer()
+	muxer.SetTrailingSlashPolicy(TrailingSlashIgnore)
+	muxer.AddHandler("/sub/", sub)
+
+	for _, path := range []string{"/sub", "/sub/"} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != "sub" {
+			t.Errorf("handler returned unexpected: want %v, but got %v", "sub", body)
+		}
+	}
+}
+
+func TestEmptyPath(t *testing.T) {
+	root := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("root"))
+	}
+
+	routed := NewMuxer()
+	routed.AddGetHandlerFunc("/", root)
+
+	mounted := NewMuxer()
+	mounted.Mount("/", http.HandlerFunc(root))
+
+	subMuxer := NewMuxer()
+	subMuxer.AddGetHandlerFunc("/", root)
+	nested := NewMuxer()
+	nested.AddHandler("/*", subMuxer)
+
+	for _, muxer := range []Muxer{routed, mounted, nested} {
+		// An absolute URL without a path leaves the request with an empty path.
+		req, err := http.NewRequest("GET", "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != "root" {
+			t.Errorf("handler returned unexpected: want %v, but got %v", "root", body)
+		}
+	}
+}
+
+func TestTrailingSlashRedirect(t *testing.T) {
+	muxer := NewMuxer()
+	subMuxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	muxer.SetTrailingSlashPolicy(TrailingSlashRedirect)
+	subMuxer.SetTrailingSlashPolicy(TrailingSlashRedirect)
+	muxer.AddGetHandlerFunc("/foo", noop)
+	muxer.AddPostHandlerFunc("/bar/", noop)
+	subMuxer.AddGetHandlerFunc("/baz", noop)
+	muxer.Mount("/sub", subMuxer)
+
+	for _, test := range []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{"GET", "/foo/?a=b", http.StatusMovedPermanently, "/foo?a=b"},
+		{"POST", "/bar", http.StatusPermanentRedirect, "/bar/"},
+		{"GET", "/sub/baz/", http.StatusMovedPermanently, "/sub/baz"},
+	} {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if status := rr.Result().StatusCode; status != test.status {
+			t.Errorf(
+				"Status code is not what is expected: want %d, but got %d",
+				test.status,
+				status,
+			)
+		}
+
+		if location := rr.Header().Get("Location"); location != test.location {
+			t.Errorf(
+				"Location is not what is expected: want %s, but got %s",
+				test.location,
+				location,
+			)
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.SetCleanPath(true)
+	muxer.AddGetHandlerFunc("/foo/bar", func(w http.ResponseWriter, r *http.Request) {})
+
+	for path, location := range map[string]string{
+		"/foo//bar":       "/foo/bar",
+		"/foo/baz/../bar": "/foo/bar",
+		"/foo/./bar/":     "/foo/bar/",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if status := rr.Result().StatusCode; status != http.StatusMovedPermanently {
+			t.Errorf(
+				"Status code is not what is expected: want %d, but got %d",
+				http.StatusMovedPermanently,
+				status,
+			)
+		}
+
+		if actual := rr.Header().Get("Location"); actual != location {
+			t.Errorf(
+				"Location is not what is expected: want %s, but got %s",
+				location,
+				actual,
+			)
+		}
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.SetCasePolicy(CaseInsensitive)
+	muxer.AddGetHandlerFunc(
+		"/Users/:name/profile",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(Params(r)["name"]))
+		},
+	)
+
+	for path, expected := range map[string]string{
+		"/Users/JaneDoe/profile": "JaneDoe",
+		"/users/JaneDoe/PROFILE": "JaneDoe",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+		}
+	}
+}
+
+func TestCaseSensitiveByDefault(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc("/foo", func(w http.ResponseWriter, r *http.Request) {})
+
+	req, err := http.NewRequest("GET", "/FOO", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Result().StatusCode; status != http.StatusNotFound {
+		t.Errorf(
+			"Status code is not what is expected: want %d, but got %d",
+			http.StatusNotFound,
+			status,
+		)
+	}
+}
+
+func TestCaseRedirect(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	muxer.SetCasePolicy(CaseRedirect)
+	muxer.SetTrailingSlashPolicy(TrailingSlashRedirect)
+	muxer.AddGetHandlerFunc("/Users/:name/profile", noop)
+	muxer.AddGetHandlerFunc("/static/*filepath", noop)
+
+	for path, location := range map[string]string{
+		"/users/JaneDoe/Profile?a=b": "/Users/JaneDoe/profile?a=b",
+		"/users/JaneDoe/Profile/":    "/Users/JaneDoe/profile",
+		"/STATIC/Main.css":           "/static/Main.css",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if status := rr.Result().StatusCode; status != http.StatusMovedPermanently {
+			t.Errorf(
+				"Status code is not what is expected: want %d, but got %d",
+				http.StatusMovedPermanently,
+				status,
+			)
+		}
+
+		if actual := rr.Header().Get("Location"); actual != location {
+			t.Errorf(
+				"Location is not what is expected: want %s, but got %s",
+				location,
+				actual,
+			)
+		}
+	}
+}
+
+func TestUseRawPath(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.SetUseRawPath(true)
+	muxer.AddGetHandlerFunc(
+		"/files/:name",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(Params(r)["name"]))
+		},
+	)
+	muxer.AddGetHandlerFunc(
+		"/files/:name/versions/*version",
+		func(w http.ResponseWriter, r *http.Request) {
+			params := Params(r)
+			w.Write([]byte(params["name"] + " " + params["version"]))
+		},
+	)
+	muxer.Mount("/objects", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + r.URL.EscapedPath()))
+	}))
+	for _, route := range []string{"/héllo", "/a b/:id"} {
+		muxer.AddGetHandlerFunc(route, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.URL.Path))
+		})
+	}
+
+	for path, expected := range map[string]string{
+		"/h%C3%A9llo":                   "/héllo",
+		"/a%20b/1":                      "/a b/1",
+		"/files/a%2Fb":                  "a/b",
+		"/files/a%20b":                  "a b",
+		"/files/a%2Fb/versions/v%2F1/x": "a/b v/1/x",
+		"/objects/bucket/a%2Fb":         "/bucket/a/b /bucket/a%2Fb",
+	} {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+		}
+	}
+}
+
+func TestWithoutRawPath(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc(
+		"/files/:name",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(Params(r)["name"]))
+		},
+	)
+
+	req, err := http.NewRequest("GET", "/files/a%2Fb", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Result().StatusCode; status != http.StatusNotFound {
+		t.Errorf(
+			"Status code is not what is expected: want %d, but got %d",
+			http.StatusNotFound,
+			status,
+		)
+	}
+}
+
+func TestHost(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.Host("api.example.com", func(g *Group) {
+		g.AddGetHandlerFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("api"))
+		})
+	})
+	muxer.Host("{tenant}.example.com", func(g *Group) {
+		g.AddGetHandlerFunc("/users/:id", func(w http.ResponseWriter, r *http.Request) {
+			params := Params(r)
+			w.Write([]byte(params["tenant"] + " " + params["id"]))
+		})
+	})
+	muxer.AddGetHandlerFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("fallback"))
+	})
+
+	for _, test := range []struct {
+		host     string
+		path     string
+		expected string
+	}{
+		{"api.example.com", "/users", "api"},
+		{"API.example.com:8080", "/users", "api"},
+		{"acme.example.com", "/users/42", "acme 42"},
+		{"acme.example.com", "/users", "Not found"},
+		{"example.org", "/users", "fallback"},
+	} {
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = test.host
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+
+	expected := []Route{
+		{Host: "api.example.com", Pattern: "/users", Methods: []string{"GET"}},
+		{Host: "{tenant}.example.com", Pattern: "/users/:id", Methods: []string{"GET"}},
+		{Pattern: "/users", Methods: []string{"GET"}},
+	}
+	if routes := muxer.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Routes are unexpected: want %v, but got %v", expected, routes)
+	}
+}
+
+func TestInvalidHost(t *testing.T) {
+	muxer := NewMuxer()
+	if err := muxer.Host("{tenant.example.com", func(g *Group) {}); err == nil {
+		t.Error("Expected the unclosed brace to be rejected")
+	}
+}
+
+func TestMatchedHandlers(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1"))
+	})
+	muxer.AddMatchedHandlerFunc(
+		"GET",
+		"/users",
+		[]Matcher{MatchHeader("Accept", "application/vnd.v2+json")},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("v2"))
+		},
+	)
+	muxer.AddMatchedHandlerFunc(
+		"GET",
+		"/users",
+		[]Matcher{MatchQuery("beta", "")},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("beta"))
+		},
+	)
+
+	for _, test := range []struct {
+		path     string
+		accept   string
+		expected string
+	}{
+		{"/users", "", "v1"},
+		{"/users", "text/html, application/vnd.v2+json", "v2"},
+		{"/users?beta", "", "beta"},
+		{"/users?beta=1", "application/vnd.v2+json", "v2"},
+	} {
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(test.accept) > 0 {
+			req.Header.Set("Accept", test.accept)
+		}
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+}
+
+func TestMatchedHandlersFallThrough(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddMatchedHandlerFunc(
+		"POST",
+		"/upload",
+		[]Matcher{MatchContentType("application/json")},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("json"))
+		},
+	)
+	muxer.AddGetHandlerFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("form"))
+	})
+
+	for _, test := range []struct {
+		method      string
+		contentType string
+		status      int
+		expected    string
+	}{
+		{"POST", "application/json; charset=utf-8", http.StatusOK, "json"},
+		{"POST", "text/plain", http.StatusNotFound, "Not found"},
+		{"PUT", "application/json", http.StatusMethodNotAllowed, "Method not allowed"},
+	} {
+		req, err := http.NewRequest(test.method, "/upload", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", test.contentType)
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.status {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.status, status)
+		}
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+
+	expected := []Route{{Pattern: "/upload", Methods: []string{"GET", "POST"}}}
+	if routes := muxer.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Routes are unexpected: want %v, but got %v", expected, routes)
+	}
+}
+
+func TestMatchedHandlersDoNotConflict(t *testing.T) {
+	muxer := NewMuxer()
+	matchers := []Matcher{MatchQuery("v", "2")}
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	if err := muxer.AddMatchedHandlerFunc("GET", "/a", matchers, handler); err != nil {
+		t.Error(err)
+	}
+	if err := muxer.AddMatchedHandlerFunc("GET", "/a", matchers, handler); err != nil {
+		t.Error(err)
+	}
+	if err := muxer.AddGetHandlerFunc("/a", handler); err != nil {
+		t.Error(err)
+	}
+	if err := muxer.AddGetHandlerFunc("/a", handler); err == nil {
+		t.Error("Expected the second GET handler without matchers to conflict")
+	}
+}
+
+func TestAddingRoutesWhileServing(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("root"))
+	})
+	var tenants *Group
+	muxer.Host("{tenant}.example.com", func(g *Group) {
+		tenants = g
+	})
+
+	const routes = 50
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				req, err := http.NewRequest(
+					"GET",
+					fmt.Sprintf("/plugins/%d", i),
+					nil,
+				)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if i%2 == 0 {
+					req.Host = "acme.example.com"
+				}
+
+				rr := httptest.NewRecorder()
+				muxer.ServeHTTP(rr, req)
+
+				status := rr.Code
+				if status != http.StatusOK && status != http.StatusNotFound {
+					t.Errorf("handler returned unexpected: want %v, but got %v", http.StatusOK, status)
+					return
+				}
+			}
+		}(i)
+	}
+
+	for i := 0; i < routes; i++ {
+		route := fmt.Sprintf("/plugins/%d", i)
+		handler := func(w http.ResponseWriter, r *http.Request) {}
+		if err := muxer.AddGetHandlerFunc(route, handler); err != nil {
+			t.Error(err)
+		}
+		if err := muxer.AddPostHandlerFunc(route, handler); err != nil {
+			t.Error(err)
+		}
+		if err := tenants.AddGetHandlerFunc(route, handler); err != nil {
+			t.Error(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if count := len(muxer.Routes()); count != 2*routes+1 {
+		t.Errorf("Routes are unexpected: want %v, but got %v", 2*routes+1, count)
+	}
+}
+
+func TestRemovingRoutesWhileServing(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc("/plugins/kept", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("kept"))
+	})
+
+	const routes = 50
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	for i := 0; i < routes; i++ {
+		route := fmt.Sprintf("/plugins/%d", i)
+		muxer.AddGetHandlerFunc(route, handler)
+		muxer.AddPostHandlerFunc(route, handler)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				req, err := http.NewRequest(
+					"GET",
+					fmt.Sprintf("/plugins/%d", i),
+					nil,
+				)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				rr := httptest.NewRecorder()
+				muxer.ServeHTTP(rr, req)
+
+				status := rr.Code
+				if status != http.StatusOK &&
+					status != http.StatusNotFound &&
+					status != http.StatusMethodNotAllowed {
+					t.Errorf("handler returned unexpected: want %v, but got %v", http.StatusOK, status)
+					return
+				}
+
+				req, err = http.NewRequest("GET", "/plugins/kept", nil)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+
+				rr = httptest.NewRecorder()
+				muxer.ServeHTTP(rr, req)
+
+				if status := rr.Code; status != http.StatusOK {
+					t.Errorf("handler returned unexpected: want %v, but got %v", http.StatusOK, status)
+					return
+				}
+			}
+		}(i)
+	}
+
+	for i := 0; i < routes; i++ {
+		route := fmt.Sprintf("/plugins/%d", i)
+		if err := muxer.Remove("GET", route); err != nil {
+			t.Error(err)
+		}
+		if err := muxer.RemoveAll(route); err != nil {
+			t.Error(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if count := len(muxer.Routes()); count != 1 {
+		t.Errorf("Routes are unexpected: want %v, but got %v", 1, count)
+	}
+}
+
+func BenchmarkAddRoutes(b *testing.B) {
+	const routes = 2000
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+	paths := make([]string, routes)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("/api/v%d/items/%d/:id", i%4, i)
+	}
+
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		muxer := NewMuxer()
+		for _, path := range paths {
+			if err := muxer.AddGetHandlerFunc(path, handler); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	muxer := NewMuxer()
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}
+	muxer.AddGetHandlerFunc("/flags/:id", handler)
+	muxer.AddPostHandlerFunc("/flags/:id", handler)
+	muxer.AddMatchedHandlerFunc(
+		"GET",
+		"/flags/:id",
+		[]Matcher{MatchQuery("beta", "")},
+		handler,
+	)
+	muxer.AddGetHandlerFunc("/flags/:id/history", handler)
+
+	if err := muxer.Remove("GET", "/flags/:id"); err != nil {
+		t.Error(err)
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"GET", "/flags/1", http.StatusMethodNotAllowed},
+		{"GET", "/flags/1?beta", http.StatusMethodNotAllowed},
+		{"POST", "/flags/1", http.StatusOK},
+		{"GET", "/flags/1/history", http.StatusOK},
+	} {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.status {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.status, status)
+		}
+	}
+
+	err := muxer.Remove("GET", "/flags/:id")
+	if _, ok := err.(*RouteNotFoundError); !ok {
+		t.Errorf("Expected a RouteNotFoundError, but got %v", err)
+	}
+
+	if err := muxer.RemoveAll("/flags/:id"); err != nil {
+		t.Error(err)
+	}
+	if err := muxer.RemoveAll("/flags/:id"); err == nil {
+		t.Error("Expected /flags/:id to have already been removed")
+	}
+
+	expected := []Route{{Pattern: "/flags/:id/history", Methods: []string{"GET"}}}
+	if routes := muxer.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Routes are unexpected: want %v, but got %v", expected, routes)
+	}
+
+	// Once removed, a route can be added all over again.
+	if err := muxer.AddGetHandlerFunc("/flags/:id", handler); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRemoveMount(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.Group("/plugins", func(g *Group) {
+		g.Mount("/chat", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	})
+
+	if err := muxer.Remove("GET", "/plugins/chat/*"); err == nil {
+		t.Error("Expected a handler for all methods to not be removed for one method")
+	}
+	if err := muxer.RemoveAll("/plugins/chat"); err == nil {
+		t.Error("Expected the mount to only be removed by its own pattern")
+	}
+	if err := muxer.RemoveAll("/plugins/chat/*"); err != nil {
+		t.Error(err)
+	}
+
+	req, err := http.NewRequest("GET", "/plugins/chat/rooms", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusNotFound {
+		t.Errorf("handler returned unexpected: want %v, but got %v", http.StatusNotFound, status)
+	}
+}
+
+func TestOptionalParams(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.AddGetHandlerFunc("/archive/:year/:month?", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r))))
+	})
+	muxer.AddGetHandlerFunc("/docs(/:version)?/*page", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r))))
+	})
+
+	for _, test := range []struct {
+		path     string
+		expected string
+	}{
+		{"/archive/2020", "map[year:2020]"},
+		{"/archive/2020/05", "map[month:05 year:2020]"},
+		{"/archive/2020/05/01", "Not found"},
+		{"/docs/v2/intro", "map[page:intro version:v2]"},
+		{"/docs/v2/guide/intro", "map[page:guide/intro version:v2]"},
+	} {
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+
+	expected := []Route{
+		{Pattern: "/archive/:year/:month?", Methods: []string{"GET"}},
+		{Pattern: "/docs(/:version)?/*page", Methods: []string{"GET"}},
+	}
+	if routes := muxer.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Routes are unexpected: want %v, but got %v", expected, routes)
+	}
+}
+
+func TestOptionalParamsConflict(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	muxer.AddGetHandlerFunc("/archive/:year", noop)
+
+	err := muxer.AddGetHandlerFunc("/archive/:year/:month?", noop)
+	conflict, ok := err.(*ConflictError)
+	if !ok {
+		t.Fatalf("Expected a conflict error, but got %v", err)
+	}
+	if conflict.Route != "/archive/:year/:month?" {
+		t.Errorf("Expected the route to be /archive/:year/:month?, but got %s", conflict.Route)
+	}
+
+	// None of the expansions should have been added.
+	expected := []Route{{Pattern: "/archive/:year", Methods: []string{"GET"}}}
+	if routes := muxer.Routes(); !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Routes are unexpected: want %v, but got %v", expected, routes)
+	}
+}
+
+func TestRemoveOptionalParams(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	muxer.AddGetHandlerFunc("/archive/:year/:month?", noop)
+
+	if err := muxer.Remove("GET", "/archive/:year"); err == nil {
+		t.Error("Expected an expansion to not be removable on its own")
+	}
+	if err := muxer.Remove("", "/archive/:year/:month?"); err == nil {
+		t.Error("Expected an empty method to be rejected")
+	}
+	if err := muxer.Remove("GET", "/archive/:year/:month?"); err != nil {
+		t.Error(err)
+	}
+	if routes := muxer.Routes(); len(routes) > 0 {
+		t.Errorf("Expected every expansion to be removed, but got %v", routes)
+	}
+}
+
+func TestURLAfterRemove(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	muxer.AddGetHandlerFunc("/users/:id", noop)
+	muxer.AddPutHandlerFunc("/users/:id", noop)
+	muxer.Name("user.show", "/users/:id")
+
+	if err := muxer.Remove("GET", "/users/:id"); err != nil {
+		t.Error(err)
+	}
+	if path, err := muxer.URL("user.show", "id", "42"); err != nil {
+		t.Error(err)
+	} else if path != "/users/42" {
+		t.Errorf("URL is unexpected: want %v, but got %v", "/users/42", path)
+	}
+
+	if err := muxer.Remove("PUT", "/users/:id"); err != nil {
+		t.Error(err)
+	}
+	if _, err := muxer.URL("user.show", "id", "42"); err == nil {
+		t.Error("Expected an error for building the URL of a removed route")
+	}
+
+	muxer.AddGetHandlerFunc("/users/:id", noop)
+	if path, err := muxer.URL("user.show", "id", "42"); err != nil {
+		t.Error(err)
+	} else if path != "/users/42" {
+		t.Errorf("URL is unexpected: want %v, but got %v", "/users/42", path)
+	}
+}
+
+func TestURLWithOptionalParams(t *testing.T) {
+	muxer := NewMuxer()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	muxer.AddGetHandlerFunc("/archive/:year/:month?", noop)
+	if err := muxer.Name("archive", "/archive/:year/:month?"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		pairs    []string
+		expected string
+	}{
+		{[]string{"year", "2020"}, "/archive/2020"},
+		{[]string{"year", "2020", "month", "05"}, "/archive/2020/05"},
+	} {
+		url, err := muxer.URL("archive", test.pairs...)
+		if err != nil {
+			t.Error(err)
+		}
+		if url != test.expected {
+			t.Errorf("URL is unexpected: want %v, but got %v", test.expected, url)
+		}
+	}
+
+	if _, err := muxer.URL("archive", "month", "05"); err == nil {
+		t.Error("Expected the missing year to be rejected")
+	}
+}
+
+func TestMixedSegments(t *testing.T) {
+	muxer := NewMuxer()
+	write := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fmt.Sprint(Params(r))))
+	}
+	muxer.AddGetHandlerFunc("/files/:name.:ext", write)
+	muxer.AddPostHandlerFunc("/files/:base.:format", write)
+	muxer.AddGetHandlerFunc("/files/:id", write)
+	muxer.AddGetHandlerFunc("/v:version{int}/items", write)
+	muxer.AddGetHandlerFunc("/@:username", write)
+
+	for _, test := range []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{"GET", "/files/notes.txt", "map[ext:txt name:notes]"},
+		{"POST", "/files/notes.txt", "map[base:notes format:txt]"},
+		{"GET", "/files/notes", "map[id:notes]"},
+		{"GET", "/v2/items", "map[version:2]"},
+		{"GET", "/vNext/items", "Not found"},
+		{"GET", "/@gopher", "map[username:gopher]"},
+	} {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+
+	if err := muxer.Name("file", "/files/:name.:ext"); err != nil {
+		t.Fatal(err)
+	}
+	url, err := muxer.URL("file", "name", "notes", "ext", "txt")
+	if err != nil {
+		t.Error(err)
+	}
+	if url != "/files/notes.txt" {
+		t.Errorf("URL is unexpected: want %v, but got %v", "/files/notes.txt", url)
+	}
+}
+
+func TestRoutePrecedence(t *testing.T) {
+	muxer := NewMuxer()
+	write := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path + " " + fmt.Sprint(Params(r))))
+	}
+	muxer.AddGetHandlerFunc("/users/me", write)
+	muxer.AddGetHandlerFunc("/users/:id", write)
+	muxer.AddGetHandlerFunc("/users/:id/posts", write)
+	muxer.AddGetHandlerFunc("/files/*path", write)
+	muxer.AddGetHandlerFunc("/files/:name", write)
+	muxer.AddGetHandlerFunc("/files/shared/readme", write)
+	muxer.AddGetHandlerFunc("/videos/:id{int}/edit", write)
+	muxer.AddHandlerFunc("/*rest", write)
+
+	for _, test := range []struct {
+		path     string
+		expected string
+	}{
+		// Static over param.
+		{"/users/me", "/users/me map[]"},
+		{"/users/42", "/users/42 map[id:42]"},
+
+		// Backtracking out of a static branch that dead-ends.
+		{"/users/me/posts", "/users/me/posts map[id:me]"},
+
+		// Param over wildcard.
+		{"/files/notes", "/files/notes map[name:notes]"},
+		{"/files/notes/old", "/files/notes/old map[path:notes/old]"},
+
+		// A wildcard higher up catches what a deeper branch can't.
+		{"/files/shared/readme/raw", "/files/shared/readme/raw map[path:shared/readme/raw]"},
+		{"/videos/abc/edit", "/videos/abc/edit map[rest:videos/abc/edit]"},
+		{"/users/me/likes", "/users/me/likes map[rest:users/me/likes]"},
+	} {
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+	}
+}
+
+func TestRoutePrecedenceByMethod(t *testing.T) {
+	muxer := NewMuxer()
+	write := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		}
+	}
+	muxer.AddGetHandlerFunc("/y/*", write("wildcard"))
+	muxer.AddPostHandlerFunc("/y/z", write("native"))
+
+	for _, test := range []struct {
+		method   string
+		path     string
+		status   int
+		expected string
+	}{
+		// A deeper route that doesn't serve the method is a dead end.
+		{"GET", "/y/z", http.StatusOK, "wildcard"},
+		{"HEAD", "/y/z", http.StatusOK, ""},
+		{"POST", "/y/z", http.StatusOK, "native"},
+
+		// Nothing serves the method, and so every route that accepts the path
+		// tells which methods are allowed.
+		{"DELETE", "/y/z", http.StatusMethodNotAllowed, "Method not allowed"},
+		{"OPTIONS", "/y/z", http.StatusNoContent, ""},
+	} {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != test.status {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.status, status)
+		}
+		if body := rr.Body.String(); body != test.expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", test.expected, body)
+		}
+		if test.status != http.StatusOK {
+			expected := "GET, HEAD, OPTIONS, POST"
+			if allow := rr.Header().Get("Allow"); allow != expected {
+				t.Errorf("handler returned unexpected: want %v, but got %v", expected, allow)
+			}
+		}
+	}
+}
+
+func TestHostPrecedence(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.Host("{tenant}.example.com", func(g *Group) {
+		g.AddGetHandlerFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("tenant " + Params(r)["tenant"]))
+		})
+	})
+	muxer.Host("api.example.com", func(g *Group) {
+		g.AddGetHandlerFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("api"))
+		})
+	})
+
+	for host, expected := range map[string]string{
+		"api.example.com":  "api",
+		"acme.example.com": "tenant acme",
+	} {
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = host
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+
+		if body := rr.Body.String(); body != expected {
+			t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+		}
+	}
+}
+
+func TestHostFallback(t *testing.T) {
+	muxer := NewMuxer()
+	muxer.Host("{tenant}.example.com", func(g *Group) {
+		g.AddGetHandlerFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("dashboard"))
+		})
+	})
+	muxer.AddGetHandlerFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("health " + Params(r)["tenant"]))
+	})
+
+	serve := func() string {
+		req, err := http.NewRequest("GET", "/health", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Host = "acme.example.com"
+
+		rr := httptest.NewRecorder()
+		muxer.ServeHTTP(rr, req)
+		return rr.Body.String()
+	}
+
+	if body := serve(); body != "Not found" {
+		t.Errorf("handler returned unexpected: want %v, but got %v", "Not found", body)
+	}
+
+	if err := muxer.SetHostFallback("{tenant}.example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	if body := serve(); body != "health acme" {
+		t.Errorf("handler returned unexpected: want %v, but got %v", "health acme", body)
+	}
+
+	if err := muxer.SetHostFallback("www.example.com", true); err == nil {
+		t.Error("Expected a host that was never added to be rejected")
+	}
+}
@@ -0,0 +1,110 @@
+package muxer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A piece of a route pattern, which is either always there, or optional.
+type patternPiece struct {
+	text     string
+	optional bool
+}
+
+// Expands a route pattern with optional parts into every route pattern that it
+// stands for. There are two ways of marking a part of the route as optional.
+// A parameter followed by a question mark, as in `/archive/:year/:month?`, or
+// a group of components wrapped in parentheses and followed by a question
+// mark, as in `/docs(/:version)?`.
+//
+// The expansions are ordered from the one with every optional part in it, to
+// the one without any. A route without optional parts expands to itself.
+func expandOptional(route string) ([]string, error) {
+	pieces := []patternPiece{}
+	var current strings.Builder
+	depth := 0
+	for i := 0; i < len(route); i++ {
+		c := route[i]
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case depth > 0:
+		case c == '(':
+			end := strings.IndexByte(route[i:], ')')
+			if end < 0 {
+				return nil, fmt.Errorf("route %s has an unclosed parenthesis", route)
+			}
+			end += i
+			group := route[i+1 : end]
+			if strings.ContainsAny(group, "()") {
+				return nil, fmt.Errorf("route %s has nested parentheses", route)
+			}
+			if !strings.HasPrefix(group, "/") {
+				return nil, fmt.Errorf(
+					"optional part (%s) of route %s must begin with a slash",
+					group,
+					route,
+				)
+			}
+			if end+1 >= len(route) || route[end+1] != '?' {
+				return nil, fmt.Errorf(
+					"parenthesized part (%s) of route %s must be followed by ?",
+					group,
+					route,
+				)
+			}
+			pieces = append(pieces, patternPiece{current.String(), false})
+			pieces = append(pieces, patternPiece{group, true})
+			current.Reset()
+			i = end + 1
+			continue
+		case c == ')':
+			return nil, fmt.Errorf("route %s has an unopened parenthesis", route)
+		case c == '?':
+			text := current.String()
+			slash := strings.LastIndexByte(text, '/')
+			if slash < 0 || !isCapturing(text[slash+1:]) {
+				return nil, fmt.Errorf(
+					"only parameters can be marked optional in route %s",
+					route,
+				)
+			}
+			if i+1 < len(route) && route[i+1] != '/' && route[i+1] != '(' {
+				return nil, fmt.Errorf(
+					"optional parameter %s of route %s must end the component",
+					text[slash+1:],
+					route,
+				)
+			}
+			pieces = append(pieces, patternPiece{text[:slash], false})
+			pieces = append(pieces, patternPiece{text[slash:], true})
+			current.Reset()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	pieces = append(pieces, patternPiece{current.String(), false})
+
+	expansions := []string{""}
+	for _, piece := range pieces {
+		next := make([]string, 0, 2*len(expansions))
+		for _, expansion := range expansions {
+			next = append(next, expansion+piece.text)
+			if piece.optional {
+				next = append(next, expansion)
+			}
+		}
+		expansions = next
+	}
+
+	// Leaving out everything that follows the very first slash still leaves the
+	// root behind.
+	for i, expansion := range expansions {
+		if len(expansion) <= 0 {
+			expansions[i] = "/"
+		}
+	}
+	return expansions, nil
+}
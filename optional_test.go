@@ -0,0 +1,49 @@
+package muxer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandOptional(t *testing.T) {
+	for _, test := range []struct {
+		route    string
+		expected []string
+	}{
+		{"/users/:id", []string{"/users/:id"}},
+		{"/archive/:year/:month?", []string{"/archive/:year/:month", "/archive/:year"}},
+		{"/docs(/:version)?", []string{"/docs/:version", "/docs"}},
+		{"/docs(/v/:version)?/*", []string{"/docs/v/:version/*", "/docs/*"}},
+		{"/:lang?", []string{"/:lang", "/"}},
+		{"/:id{[0-9]?}?", []string{"/:id{[0-9]?}", "/"}},
+		{
+			"/archive/:year?/:month?",
+			[]string{"/archive/:year/:month", "/archive/:year", "/archive/:month", "/archive"},
+		},
+	} {
+		expansions, err := expandOptional(test.route)
+		if err != nil {
+			t.Errorf("Expected %s to expand, but got %v", test.route, err)
+			continue
+		}
+		if !reflect.DeepEqual(expansions, test.expected) {
+			t.Errorf("Expansions of %s are unexpected: want %v, but got %v", test.route, test.expected, expansions)
+		}
+	}
+}
+
+func TestInvalidOptional(t *testing.T) {
+	for _, route := range []string{
+		"/docs(/:version",
+		"/docs/:version)?",
+		"/docs(/:version)",
+		"/docs(:version)?",
+		"/docs((/:version))?",
+		"/docs?",
+		"/files/:name?.txt",
+	} {
+		if _, err := expandOptional(route); err == nil {
+			t.Errorf("Expected %s to be rejected", route)
+		}
+	}
+}
@@ -1,31 +1,176 @@
 package muxer
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
 // Params grabs the parameters from the URL.
 func Params(r *http.Request) map[string]string {
-	previousPathOffset, ok :=
-		r.Context().Value(previousPathOffsetContextKey).(int)
+	result := make(map[string]string)
+	params, _ := r.Context().Value(paramsContextKey).(map[string]string)
+	for name, value := range params {
+		result[name] = value
+	}
+	return result
+}
+
+// Adds the parameters that were captured while matching the request to the
+// request's context. Parameters that had been captured by outer muxers are
+// kept around.
+func withParams(r *http.Request, params map[string]string) *http.Request {
+	previous, _ := r.Context().Value(paramsContextKey).(map[string]string)
+	merged := make(map[string]string, len(previous)+len(params))
+	for name, value := range previous {
+		merged[name] = value
+	}
+	for name, value := range params {
+		merged[name] = value
+	}
+	ctx := context.WithValue(r.Context(), paramsContextKey, merged)
+	return r.WithContext(ctx)
+}
+
+// Grabs a single parameter, failing if it is missing.
+func param(r *http.Request, name string) (string, error) {
+	value, ok := Params(r)[name]
 	if !ok {
-		previousPathOffset = 0
+		return "", &ParamError{Name: name}
 	}
-	routePath, ok := r.Context().Value(pathContextKey).(string)
+	return value, nil
+}
+
+// ParamOr grabs the parameter by the given name, or falls back to the given
+// value if the parameter is missing.
+func ParamOr(r *http.Request, name, fallback string) string {
+	value, ok := Params(r)[name]
 	if !ok {
-		routePath = "/"
+		return fallback
 	}
-	requestPathComponents :=
-		strings.Split(r.URL.Path[1:], "/")[previousPathOffset:]
-	routePathComponents := strings.Split(routePath[1:], "/")
+	return value
+}
 
-	result := make(map[string]string)
-	for i := 0; i < len(routePathComponents); i++ {
-		if routePathComponents[i][0] == ':' {
-			result[routePathComponents[i][1:]] = requestPathComponents[i]
+// Grabs a single parameter as an integer that fits into the given number of
+// bits.
+func paramInt(r *http.Request, name string, bits int) (int64, error) {
+	value, err := param(r, name)
+	if err != nil {
+		return 0, err
+	}
+	result, err := strconv.ParseInt(value, 10, bits)
+	if err != nil {
+		return 0, &ParamError{name, value, err.(*strconv.NumError).Err}
+	}
+	return result, nil
+}
+
+// ParamInt grabs the parameter by the given name as an int.
+func ParamInt(r *http.Request, name string) (int, error) {
+	value, err := paramInt(r, name, strconv.IntSize)
+	return int(value), err
+}
+
+// ParamInt64 grabs the parameter by the given name as an int64.
+func ParamInt64(r *http.Request, name string) (int64, error) {
+	return paramInt(r, name, 64)
+}
+
+// Compiled once, since ParamUUID may well be called on every request.
+var uuidRegex, _ = compileConstraint("uuid")
+
+// ParamUUID grabs the parameter by the given name as a UUID, in its canonical
+// lowercase form.
+func ParamUUID(r *http.Request, name string) (string, error) {
+	value, err := param(r, name)
+	if err != nil {
+		return "", err
+	}
+	if !uuidRegex.MatchString(value) {
+		return "", &ParamError{name, value, errors.New("not a UUID")}
+	}
+	return strings.ToLower(value), nil
+}
+
+// BindParams decodes the parameters into the struct that v points to. Only the
+// fields tagged with the name of a parameter are set, e.g.
+//
+//	var req struct {
+//		ID   int    `param:"id"`
+//		Slug string `param:"slug"`
+//	}
+//	err := muxer.BindParams(r, &req)
+//
+// Fields can be strings, booleans, or any of the integer and floating point
+// types. Every tagged parameter must be present.
+func BindParams(r *http.Request, v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.Elem().Kind() != reflect.Struct {
+		return errors.New("BindParams requires a pointer to a struct")
+	}
+	target = target.Elem()
+
+	params := Params(r)
+	for i := 0; i < target.NumField(); i++ {
+		field := target.Type().Field(i)
+		name, ok := field.Tag.Lookup("param")
+		if !ok || name == "-" {
+			continue
+		}
+		if !target.Field(i).CanSet() {
+			return fmt.Errorf(
+				"field %s is tagged with parameter %s, but it is unexported",
+				field.Name,
+				name,
+			)
+		}
+		value, ok := params[name]
+		if !ok {
+			return &ParamError{Name: name}
+		}
+		if err := setField(target.Field(i), value); err != nil {
+			return &ParamError{name, value, err}
 		}
 	}
 
-	return result
+	return nil
+}
+
+// Converts the value into the field's type, and sets it.
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		result, err := strconv.ParseBool(value)
+		if err != nil {
+			return err.(*strconv.NumError).Err
+		}
+		field.SetBool(result)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		result, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err.(*strconv.NumError).Err
+		}
+		field.SetInt(result)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		result, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err.(*strconv.NumError).Err
+		}
+		field.SetUint(result)
+	case reflect.Float32, reflect.Float64:
+		result, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err.(*strconv.NumError).Err
+		}
+		field.SetFloat(result)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
 }
@@ -0,0 +1,173 @@
+package muxer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Serves the request through a muxer that has the handler added under the
+// route, so that the handler gets to see the route's parameters.
+func serveWithRoute(
+	t *testing.T,
+	route, path string,
+	h func(w http.ResponseWriter, r *http.Request),
+) {
+	called := false
+	muxer := NewMuxer()
+	err := muxer.AddGetHandlerFunc(
+		route,
+		func(w http.ResponseWriter, r *http.Request) {
+			called = true
+			h(w, r)
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	muxer.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !called {
+		t.Fatalf("Expected %s to be handled by %s", path, route)
+	}
+}
+
+func TestParamInt(t *testing.T) {
+	serveWithRoute(t, "/users/:id/:name", "/users/42/foo", func(w http.ResponseWriter, r *http.Request) {
+		id, err := ParamInt(r, "id")
+		if err != nil {
+			t.Error(err)
+		}
+		if id != 42 {
+			t.Errorf("Expected id to be 42, but got %d", id)
+		}
+
+		_, err = ParamInt64(r, "name")
+		paramErr, ok := err.(*ParamError)
+		if !ok {
+			t.Fatalf("Expected a parameter error, but got %v", err)
+		}
+		if paramErr.Name != "name" || paramErr.Value != "foo" {
+			t.Errorf("Unexpected parameter error: %v", paramErr)
+		}
+
+		_, err = ParamInt(r, "nothing")
+		paramErr, ok = err.(*ParamError)
+		if !ok {
+			t.Fatalf("Expected a parameter error, but got %v", err)
+		}
+		if paramErr.Err != nil {
+			t.Errorf("Expected the parameter to be reported as missing: %v", paramErr)
+		}
+	})
+}
+
+func TestParamUUID(t *testing.T) {
+	serveWithRoute(t, "/orders/:id/:name", "/orders/123E4567-E89B-12D3-A456-426614174000/foo", func(w http.ResponseWriter, r *http.Request) {
+		id, err := ParamUUID(r, "id")
+		if err != nil {
+			t.Error(err)
+		}
+		if expected := "123e4567-e89b-12d3-a456-426614174000"; id != expected {
+			t.Errorf("Expected id to be %s, but got %s", expected, id)
+		}
+
+		if _, err := ParamUUID(r, "name"); err == nil {
+			t.Error("Expected foo to not be a UUID")
+		}
+	})
+}
+
+func TestParamOr(t *testing.T) {
+	serveWithRoute(t, "/users/:id", "/users/42", func(w http.ResponseWriter, r *http.Request) {
+		if value := ParamOr(r, "id", "0"); value != "42" {
+			t.Errorf("Expected id to be 42, but got %s", value)
+		}
+		if value := ParamOr(r, "name", "anonymous"); value != "anonymous" {
+			t.Errorf("Expected name to be anonymous, but got %s", value)
+		}
+	})
+}
+
+func TestBindParams(t *testing.T) {
+	serveWithRoute(t, "/users/:id/:name/:admin", "/users/42/foo/true", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID      int64  `param:"id"`
+			Name    string `param:"name"`
+			Admin   bool   `param:"admin"`
+			Ignored string
+		}
+		if err := BindParams(r, &req); err != nil {
+			t.Fatal(err)
+		}
+		if req.ID != 42 || req.Name != "foo" || !req.Admin {
+			t.Errorf("Unexpected parameters: %+v", req)
+		}
+
+		var malformed struct {
+			Name int `param:"name"`
+		}
+		if err := BindParams(r, &malformed); err == nil {
+			t.Error("Expected foo to not be bound to an integer")
+		}
+
+		var missing struct {
+			Page int `param:"page"`
+		}
+		if err := BindParams(r, &missing); err == nil {
+			t.Error("Expected the missing page parameter to be reported")
+		}
+
+		var unexported struct {
+			id int `param:"id"`
+		}
+		if err := BindParams(r, &unexported); err == nil {
+			t.Errorf("Expected the unexported field to be reported, but got %+v", unexported)
+		}
+	})
+}
+
+func TestParamsWithoutMuxer(t *testing.T) {
+	req, err := http.NewRequest("GET", "/foo/bar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params := Params(req); len(params) != 0 {
+		t.Errorf("Expected no parameters, but got %v", params)
+	}
+}
+
+func TestParamsFromOuterMuxer(t *testing.T) {
+	expected := "42 7"
+
+	muxer := NewMuxer()
+	subMuxer := NewMuxer()
+
+	subMuxer.AddGetHandlerFunc(
+		"/posts/:post",
+		func(w http.ResponseWriter, r *http.Request) {
+			params := Params(r)
+			w.Write([]byte(params["user"] + " " + params["post"]))
+		},
+	)
+	muxer.AddHandler("/users/:user/*", subMuxer)
+
+	req, err := http.NewRequest("GET", "/users/42/posts/7", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	muxer.ServeHTTP(rr, req)
+
+	if body := rr.Body.String(); body != expected {
+		t.Errorf("handler returned unexpected: want %v, but got %v", expected, body)
+	}
+}
@@ -0,0 +1,74 @@
+package muxer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// SetUseRawPath sets whether requests are routed on their escaped path, as
+// returned by URL.EscapedPath, rather than on URL.Path. That way, an escaped
+// slash, as in `a%2Fb`, doesn't split a path component in two.
+//
+// Static components are then matched against the path components after they
+// are unescaped, and constraints against the escaped path components, while
+// parameter values are unescaped individually before they are handed to
+// Params. It is disabled by default.
+func (m *Muxer) SetUseRawPath(enabled bool) {
+	m.useRawPath = enabled
+}
+
+// Records in the request's context whether the muxer that is currently
+// dispatching the request routes on the escaped path, so that the handlers it
+// dispatches to strip the same path that the muxer matched against.
+func withRawPath(r *http.Request, useRawPath bool) *http.Request {
+	current, _ := r.Context().Value(rawPathContextKey).(bool)
+	if current == useRawPath {
+		return r
+	}
+	ctx := context.WithValue(r.Context(), rawPathContextKey, useRawPath)
+	return r.WithContext(ctx)
+}
+
+// Determines whether the request is being routed on its escaped path.
+func usesRawPath(r *http.Request) bool {
+	useRawPath, _ := r.Context().Value(rawPathContextKey).(bool)
+	return useRawPath
+}
+
+// Gets the path of the URL that the request is being routed on.
+func routingPath(r *http.Request, u *url.URL) string {
+	if usesRawPath(r) {
+		return u.EscapedPath()
+	}
+	return u.Path
+}
+
+// Sets the path of the URL, given a path in the form that the request is being
+// routed on.
+func setRoutingPath(r *http.Request, u *url.URL, p string) {
+	if !usesRawPath(r) {
+		u.Path = p
+		u.RawPath = ""
+		return
+	}
+	unescaped, err := url.PathUnescape(p)
+	if err != nil {
+		unescaped = p
+	}
+	u.Path = unescaped
+	u.RawPath = p
+}
+
+// Unescapes a value that was captured from the path that the request is being
+// routed on. Values that can't be unescaped are left as they are.
+func unescapeCaptured(r *http.Request, value string) string {
+	if !usesRawPath(r) {
+		return value
+	}
+	unescaped, err := url.PathUnescape(value)
+	if err != nil {
+		return value
+	}
+	return unescaped
+}
@@ -0,0 +1,129 @@
+package muxer
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// TrailingSlashPolicy determines how a muxer treats a request whose path only
+// differs from a route by a trailing slash.
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashStrict treats `/foo` and `/foo/` as different paths. This is
+	// the default.
+	TrailingSlashStrict TrailingSlashPolicy = iota
+
+	// TrailingSlashIgnore serves `/foo/` with the route `/foo`, and vice versa.
+	TrailingSlashIgnore
+
+	// TrailingSlashRedirect redirects `/foo/` to the route `/foo`, and vice
+	// versa.
+	TrailingSlashRedirect
+)
+
+// SetTrailingSlashPolicy sets how requests whose path only differs from a
+// route by a trailing slash are handled.
+func (m *Muxer) SetTrailingSlashPolicy(policy TrailingSlashPolicy) {
+	m.trailingSlashPolicy = policy
+}
+
+// CasePolicy determines how a muxer treats a request whose path only differs
+// from a route by the case of its static components. The case of parameter
+// values is always left alone.
+type CasePolicy int
+
+const (
+	// CaseSensitive treats `/foo` and `/FOO` as different paths. This is the
+	// default.
+	CaseSensitive CasePolicy = iota
+
+	// CaseInsensitive serves `/FOO` with the route `/foo`.
+	CaseInsensitive
+
+	// CaseRedirect redirects `/FOO` to `/foo`, which is the way that the route
+	// was spelled when it was added.
+	CaseRedirect
+)
+
+// SetCasePolicy sets how requests whose path only differs from a route by the
+// case of its static components are handled.
+func (m *Muxer) SetCasePolicy(policy CasePolicy) {
+	m.casePolicy = policy
+}
+
+// SetCleanPath sets whether requests whose path contains `//`, `.` or `..`
+// components get redirected to the cleaned up path, in the same way that
+// http.ServeMux does. It is disabled by default.
+func (m *Muxer) SetCleanPath(enabled bool) {
+	m.cleanPath = enabled
+}
+
+// Cleans up the path in the same way as http.ServeMux does, which is to say
+// with path.Clean, except that the trailing slash is kept.
+func cleanPath(p string) string {
+	if len(p) <= 0 {
+		return "/"
+	}
+	if p[0] != '/' {
+		p = "/" + p
+	}
+	cleaned := path.Clean(p)
+	if p[len(p)-1] == '/' && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// Adds a trailing slash to the path, or removes it if it already has one.
+func toggleTrailingSlash(p string) string {
+	if strings.HasSuffix(p, "/") {
+		return p[:len(p)-1]
+	}
+	return p + "/"
+}
+
+// Gets the URL of the request, as it was before any prefix had been stripped
+// off of it by Mount.
+func originalURL(r *http.Request) *url.URL {
+	if u, ok := r.Context().Value(originalURLContextKey).(*url.URL); ok {
+		return u
+	}
+	return r.URL
+}
+
+// Replaces the part of the original path that the muxer had matched with the
+// given path. This fails if the matched path isn't the tail end of the
+// original, which can only happen for muxers added with AddHandler.
+func replaceMatchedPath(r *http.Request, matched, p string) (string, bool) {
+	original := routingPath(r, originalURL(r))
+	if !strings.HasSuffix(original, matched) {
+		return "", false
+	}
+	return original[:len(original)-len(matched)] + p, true
+}
+
+// Redirects the request to the given path, keeping the query string intact.
+// Permanent redirects for anything other than GET and HEAD requests have to use
+// 308, so that the client doesn't switch the method to GET.
+func redirect(w http.ResponseWriter, r *http.Request, p string) {
+	code := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		code = http.StatusPermanentRedirect
+	}
+	u := *originalURL(r)
+	setRoutingPath(r, &u, p)
+	http.Redirect(w, r, u.RequestURI(), code)
+}
+
+// Determines whether anything was found in the routes tree that the acceptor
+// accepts.
+func (r partialRouteResult) accepted(accept acceptor) bool {
+	if !r.retrieved {
+		return false
+	}
+	handler, ok := r.value.(*routeHandler)
+	return ok && handler != nil && accept(handler, r.remainder)
+}
@@ -0,0 +1,86 @@
+package muxer
+
+import "errors"
+
+// Remove removes the handlers that were added to the route for the method,
+// including the ones that were added with matchers. The route has to be
+// spelled the way it was added. If no such handler had been added, then a
+// RouteNotFoundError is returned. The method can't be empty. Use RemoveAll to
+// remove the handlers of every method.
+//
+// Like adding routes, removing them is safe to do while the muxer is serving
+// requests.
+func (m *Muxer) Remove(method, route string) error {
+	if len(method) <= 0 {
+		return errors.New("method cannot be empty")
+	}
+	return removeRoute(m.routes, method, route)
+}
+
+// RemoveAll removes every handler that was added to the route, regardless of
+// the method, including a handler that was added through AddHandler or Mount.
+// If nothing had been added to the route, then a RouteNotFoundError is
+// returned.
+func (m *Muxer) RemoveAll(route string) error {
+	return removeRoute(m.routes, "", route)
+}
+
+// Remove removes the handlers that were added to the route under the group's
+// prefix for the method. See Muxer.Remove.
+func (g *Group) Remove(method, route string) error {
+	if len(method) <= 0 {
+		return errors.New("method cannot be empty")
+	}
+	return removeRoute(g.routes, method, joinRoutes(g.prefix, route))
+}
+
+// RemoveAll removes every handler that was added to the route under the
+// group's prefix. See Muxer.RemoveAll.
+func (g *Group) RemoveAll(route string) error {
+	return removeRoute(g.routes, "", joinRoutes(g.prefix, route))
+}
+
+// Removes the handlers for the method from the route, or the handlers for every
+// method if the method is empty. Nodes of the routes tree that are left with
+// nothing in them are pruned. A route with optional parts is removed along
+// with every one of its expansions.
+func removeRoute(table *routeTable, method, path string) error {
+	if err := validatePath(path); err != nil {
+		return err
+	}
+
+	expansions, err := expandOptional(path)
+	if err != nil {
+		return err
+	}
+
+	return table.update(func(tree *routes) error {
+		for _, expansion := range expansions {
+			err := removeExpansion(tree, method, path, expansion)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Removes the handlers that were added under the pattern from the node of the
+// routes tree that the expansion of the pattern leads to.
+func removeExpansion(tree *routes, method, pattern, expansion string) error {
+	nonWildcardPath := extractRelevantPath(expansion)
+	notFound := &RouteNotFoundError{Method: method, Route: pattern}
+	existing, ok := tree.find(nonWildcardPath).(*routeHandler)
+	if !ok {
+		return notFound
+	}
+	handler, removed := existing.without(method, pattern)
+	if !removed {
+		return notFound
+	}
+	if len(*handler) > 0 {
+		return tree.add(nonWildcardPath, handler)
+	}
+	tree.remove(nonWildcardPath)
+	return nil
+}
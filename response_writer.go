@@ -0,0 +1,15 @@
+package muxer
+
+import (
+	"net/http"
+)
+
+// A response writer for HEAD requests that are being served by a GET handler.
+// The headers and the status code make it through, but the body does not.
+type headResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w headResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -2,15 +2,149 @@ package muxer
 
 import (
 	"net/http"
+	"sort"
+	"strings"
 )
 
-type routeHandler map[string]http.Handler
+// The method that the handlers for all methods are kept under. They only get
+// the requests whose method has no handler of its own.
+const anyMethod = ""
+
+// Every method can have several handlers, each of which only accepts the
+// requests that satisfy its matchers. They are tried in the order in which they
+// were added, except for the handler without any matchers, which is always
+// tried last.
+type routeHandler map[string][]wrappedHandler
+
+// clone copies the handlers of every method, so that handlers can be added to
+// the copy while the original is still being used to dispatch requests.
+func (r routeHandler) clone() *routeHandler {
+	handler := make(routeHandler, len(r))
+	for method, handlers := range r {
+		handler[method] = append([]wrappedHandler(nil), handlers...)
+	}
+	return &handler
+}
+
+// without copies the route handler, leaving out the handlers that were added
+// under the route pattern, as it was spelled when they were added. Only the
+// method's handlers are left out, or the handlers of every method, including
+// the handlers for all methods, if the method is empty. It also reports
+// whether anything was left out.
+func (r routeHandler) without(method, pattern string) (*routeHandler, bool) {
+	handler := make(routeHandler, len(r))
+	removed := false
+	for m, handlers := range r {
+		kept := []wrappedHandler{}
+		for _, h := range handlers {
+			if h.pattern == pattern && (len(method) <= 0 || m == method) {
+				removed = true
+				continue
+			}
+			kept = append(kept, h)
+		}
+		if len(kept) > 0 {
+			handler[m] = kept
+		}
+	}
+	return &handler, removed
+}
+
+// Determines whether any of the handlers, of any method, was added under the
+// route pattern, as it was spelled when they were added.
+func (r routeHandler) hasPattern(pattern string) bool {
+	for _, handlers := range r {
+		for _, h := range handlers {
+			if h.pattern == pattern {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// add adds a handler for the method, making sure that the handler without any
+// matchers stays at the very end.
+func (r routeHandler) add(method string, h wrappedHandler) {
+	handlers := r[method]
+	last := len(handlers) - 1
+	if len(h.matchers) <= 0 || last < 0 || len(handlers[last].matchers) > 0 {
+		r[method] = append(handlers, h)
+		return
+	}
+	r[method] = append(handlers[:last:last], h, handlers[last])
+}
+
+// Gets the method's handler that doesn't have any matchers, if any.
+func (r routeHandler) unconditional(method string) (wrappedHandler, bool) {
+	handlers := r[method]
+	last := len(handlers) - 1
+	if last < 0 || len(handlers[last].matchers) > 0 {
+		return wrappedHandler{}, false
+	}
+	return handlers[last], true
+}
+
+// Gets the first of the method's handlers that will accept the request, given
+// the remainder of the request path.
+func (r routeHandler) handler(
+	method string,
+	req *http.Request,
+	remainder string,
+) (wrappedHandler, bool) {
+	for _, h := range r[method] {
+		if h.matches(remainder) && h.matchesRequest(req) {
+			return h, true
+		}
+	}
+	return wrappedHandler{}, false
+}
+
+// Determines whether any of the method's handlers accepts the given remainder
+// of the request path, regardless of their matchers.
+func (r routeHandler) acceptsPath(method, remainder string) bool {
+	for _, h := range r[method] {
+		if h.matches(remainder) {
+			return true
+		}
+	}
+	return false
+}
+
+// Determines whether any of the handlers, including the ones for all methods,
+// accepts the given remainder of the request path.
+func (r routeHandler) accepts(remainder string) bool {
+	for method := range r {
+		if r.acceptsPath(method, remainder) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedMethods gets a sorted list of all the methods whose handlers will
+// accept the given remainder of the request path. The handlers for all methods
+// are left out.
+func (r routeHandler) allowedMethods(remainder string) []string {
+	methods := []string{}
+	for method := range r {
+		if method != anyMethod && r.acceptsPath(method, remainder) {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
 
 func (r *routeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	handler, ok := (*r)[req.Method]
+	handler, ok := r.handler(req.Method, req, "")
+	if !ok {
+		handler, ok = r.handler(anyMethod, req, "")
+	}
 	if !ok {
-		w.WriteHeader(404)
-		w.Write([]byte("Not found"))
+		w.Header().Set("Allow", strings.Join(r.allowedMethods(""), ", "))
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.Write([]byte("Method not allowed"))
 		return
 	}
 	handler.ServeHTTP(w, req)
@@ -0,0 +1,43 @@
+package muxer
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// A routes tree that can be looked up while routes are being added to it, or
+// removed from it. Lookups load the current tree without taking any locks.
+// Changes take turns, and every one of them is made to a copy of the tree,
+// which then replaces the current tree all at once. Requests that are already
+// being dispatched keep using the tree that they loaded.
+type routeTable struct {
+	mu      sync.Mutex
+	current atomic.Value
+}
+
+func newRouteTable() *routeTable {
+	t := &routeTable{}
+	tree := newRouter()
+	t.current.Store(&tree)
+	return t
+}
+
+// load gets the current routes tree. It must not be changed.
+func (t *routeTable) load() *routes {
+	return t.current.Load().(*routes)
+}
+
+// update calls the function with a copy of the current routes tree, which
+// replaces the current tree, unless the function returns an error. Either way,
+// the tree is never seen half changed.
+func (t *routeTable) update(fn func(tree *routes) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tree := t.load().clone()
+	if err := fn(tree); err != nil {
+		return err
+	}
+	t.current.Store(tree)
+	return nil
+}
@@ -1,75 +1,169 @@
 package muxer
 
 import (
-	"errors"
+	"net/url"
+	"regexp"
+	"sort"
 	"strings"
 )
 
 // All of this is the code associated with the tree data structure that holds
 // routing information.
 
-type routeNodeOrRouteNodeMap struct {
-	child    *routeNode
-	children *map[string]*routeNode
+// A node in the routes tree. Static path components and parameter components
+// can live side by side. When both are able to match a path component, the
+// static one wins.
+//
+// There is a parameter child for every distinct constraint at a given depth,
+// and for every distinct shape of path components that mix literal text with
+// parameters, such as `:name.:ext`. Those are treated as constrained.
+// Constrained parameters are tried in the order in which they were added,
+// before the unconstrained parameter, if any. Parameter children don't have
+// names, since every route that passes through them is free to name the
+// parameter however it wants. The names are taken from the route pattern of the
+// handler that ends up handling the request.
+type routeNode struct {
+	children map[string]*routeNode
+	params   []*routeNode
+	value    interface{}
+
+	// Only set on parameter children. The key is the shape of the path component
+	// that the child was added with. See captureKey.
+	key             string
+	constraintRegex *regexp.Regexp
 }
 
-func (r routeNodeOrRouteNodeMap) IsChildOnly() bool {
-	return r.child != nil
+func newRouteNode() routeNode {
+	var r routeNode
+	r.children = make(map[string]*routeNode)
+	return r
 }
 
-func newChild(child routeNode) *routeNodeOrRouteNodeMap {
-	newChild := child
-	return &routeNodeOrRouteNodeMap{&newChild, nil}
+// Determines whether the path component is a single parameter, such as `:id`
+// or `:id{int}`.
+func isParam(component string) bool {
+	if len(component) <= 0 || component[0] != ':' {
+		return false
+	}
+	parts := parseSegment(component)
+	return len(parts) == 1 && parts[0].param
 }
 
-func newChildren(children map[string]*routeNode) *routeNodeOrRouteNodeMap {
-	newChildren := children
-	return &routeNodeOrRouteNodeMap{nil, &newChildren}
+// add adds a new sub rooute.
+//
+// The tree is copy-on-write. The node must be a copy that nobody else can see
+// yet, and every node on the way down to the value gets copied as well, while
+// every other node is shared with the tree that the node was copied from.
+// Shared nodes, along with their children maps and parameter slices, are never
+// changed.
+func (r *routeNode) add(components []string, value interface{}) error {
+	if len(components) <= 0 {
+		r.value = value
+		return nil
+	}
+	first, remainder := components[0], components[1:]
+	if isCapturing(first) {
+		key := captureKey(first)
+		i := r.paramIndex(key)
+		var param *routeNode
+		if i < 0 {
+			node := newRouteNode()
+			node.key = key
+			regex, err := compileCapture(first)
+			if err != nil {
+				return err
+			}
+			node.constraintRegex = regex
+			param = &node
+		} else {
+			param = r.params[i].copy()
+		}
+		if err := param.add(remainder, value); err != nil {
+			return err
+		}
+		params := append([]*routeNode(nil), r.params...)
+		if i < 0 {
+			params = insertParamChild(params, param)
+		} else {
+			params[i] = param
+		}
+		r.params = params
+		return nil
+	}
+	var node *routeNode
+	if existing, ok := r.children[first]; ok {
+		node = existing.copy()
+	} else {
+		newNode := newRouteNode()
+		node = &newNode
+	}
+	if err := node.add(remainder, value); err != nil {
+		return err
+	}
+	r.children = r.childrenWith(first, node)
+	return nil
 }
 
-// A children of nodes, or just a single node.
-type routeNode struct {
-	childOrChildren *routeNodeOrRouteNodeMap
-	value           interface{}
+// copy makes a shallow copy of the node, which shares the node's children.
+func (r *routeNode) copy() *routeNode {
+	node := *r
+	return &node
 }
 
-func newRouteNode(components []string, value interface{}) routeNode {
-	var r routeNode
-	r.value = newChild
-	r.childOrChildren = newChildren(make(map[string]*routeNode))
+// Copies the node's static children, replacing the child under the key. A nil
+// child is left out altogether.
+func (r *routeNode) childrenWith(
+	key string,
+	child *routeNode,
+) map[string]*routeNode {
+	children := make(map[string]*routeNode, len(r.children)+1)
+	for k, v := range r.children {
+		children[k] = v
+	}
+	if child == nil {
+		delete(children, key)
+	} else {
+		children[key] = child
+	}
+	return children
+}
 
-	r.add(components, value)
-	return r
+// Gets the index of the parameter child with the given key, or -1 if there is
+// none.
+func (r *routeNode) paramIndex(key string) int {
+	for i, param := range r.params {
+		if param.key == key {
+			return i
+		}
+	}
+	return -1
 }
 
-// add adds a new sub rooute.
-func (r *routeNode) add(components []string, value interface{}) {
-	if len(components) <= 0 {
-		r.value = value
-	} else {
-		first, remainder := components[0], components[1:]
-		if first[0] == ':' {
-			if r.childOrChildren.IsChildOnly() {
-				r.childOrChildren.child.add(remainder, value)
-			} else {
-				r.childOrChildren = newChild(newRouteNode(remainder, value))
-			}
-		} else {
-			if r.childOrChildren.IsChildOnly() {
-				r.childOrChildren = newChildren(make(map[string]*routeNode))
-				node := newRouteNode(remainder, value)
-				(*r.childOrChildren.children)[first] = &node
-			} else {
-				node, ok := (*r.childOrChildren.children)[first]
-				if !ok {
-					node := newRouteNode(remainder, value)
-					(*r.childOrChildren.children)[first] = &node
-				} else {
-					node.add(remainder, value)
-				}
-			}
+// Gets the parameter child with the given key.
+func (r *routeNode) paramChild(key string) *routeNode {
+	for _, param := range r.params {
+		if param.key == key {
+			return param
 		}
 	}
+	return nil
+}
+
+// Inserts a parameter child, making sure that the unconstrained one stays at
+// the very end.
+func insertParamChild(params []*routeNode, param *routeNode) []*routeNode {
+	last := len(params) - 1
+	if param.constraintRegex == nil || last < 0 ||
+		params[last].constraintRegex != nil {
+		return append(params, param)
+	}
+	return append(params[:last], param, params[last])
+}
+
+// Determines whether the path component satisfies the constraint of this
+// parameter child.
+func (r *routeNode) accepts(component string) bool {
+	return r.constraintRegex == nil || r.constraintRegex.MatchString(component)
 }
 
 func (r *routeNode) get(components []string) interface{} {
@@ -77,23 +171,218 @@ func (r *routeNode) get(components []string) interface{} {
 		return r.value
 	}
 	first, remainder := components[0], components[1:]
-	if r.childOrChildren.IsChildOnly() {
-		return r.childOrChildren.child.get(remainder)
+	if node, ok := r.children[first]; ok {
+		if value := node.get(remainder); value != nil {
+			return value
+		}
+	}
+	for _, param := range r.params {
+		if !param.accepts(first) {
+			continue
+		}
+		if value := param.get(remainder); value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// find gets the value that was added under the exact same components. Unlike
+// get, parameter components only ever match the parameter child.
+func (r *routeNode) find(components []string) interface{} {
+	if len(components) <= 0 {
+		return r.value
+	}
+	first, remainder := components[0], components[1:]
+	if isCapturing(first) {
+		param := r.paramChild(captureKey(first))
+		if param == nil {
+			return nil
+		}
+		return param.find(remainder)
 	}
-	node, ok := (*r.childOrChildren.children)[first]
+	node, ok := r.children[first]
 	if !ok {
 		return nil
 	}
-	return node.get(remainder)
+	return node.find(remainder)
+}
+
+// remove removes the value that was added under the exact same components,
+// pruning the nodes that are left with nothing in them. It reports whether
+// there was a value to remove. Like add, it copies the nodes that it changes,
+// and so the node must be a copy that nobody else can see yet.
+func (r *routeNode) remove(components []string) bool {
+	if len(components) <= 0 {
+		removed := r.value != nil
+		r.value = nil
+		return removed
+	}
+	first, remainder := components[0], components[1:]
+	if isCapturing(first) {
+		i := r.paramIndex(captureKey(first))
+		if i < 0 {
+			return false
+		}
+		param := r.params[i].copy()
+		if !param.remove(remainder) {
+			return false
+		}
+		params := append([]*routeNode(nil), r.params[:i]...)
+		if !param.empty() {
+			params = append(params, param)
+		}
+		r.params = append(params, r.params[i+1:]...)
+		return true
+	}
+	existing, ok := r.children[first]
+	if !ok {
+		return false
+	}
+	node := existing.copy()
+	if !node.remove(remainder) {
+		return false
+	}
+	if node.empty() {
+		node = nil
+	}
+	r.children = r.childrenWith(first, node)
+	return true
+}
+
+// Determines whether the node has neither a value, nor any children.
+func (r *routeNode) empty() bool {
+	return r.value == nil && len(r.children) <= 0 && len(r.params) <= 0
+}
+
+// walk calls the function with every value in the tree. Static children are
+// visited in alphabetical order, followed by the parameter children.
+func (r *routeNode) walk(fn func(value interface{})) {
+	if r.value != nil {
+		fn(r.value)
+	}
+	keys := make([]string, 0, len(r.children))
+	for key := range r.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		r.children[key].walk(fn)
+	}
+	for _, param := range r.params {
+		param.walk(fn)
+	}
 }
 
 type PartialRouteNodeResult struct {
 	Retrieved bool
 	Value     interface{}
 	Remainder []string
+
+	// Only when folding case. The components that were walked through on the
+	// way to the value, with static components spelled the way they were added.
+	Path []string
 }
 
-func (r *routeNode) getPartial(components []string) PartialRouteNodeResult {
+// How the components of the path are compared against the static children of
+// the nodes of the routes tree.
+type matchMode struct {
+	// Static components match regardless of their case.
+	foldCase bool
+
+	// The path is escaped, as it is when the muxer routes on the escaped path,
+	// while static components were added unescaped.
+	unescape bool
+}
+
+// Gets the keys of the static children that match the path component. When
+// folding case, keys that only differ by case are included, after the exact
+// match.
+func (r *routeNode) staticKeys(component string, mode matchMode) []string {
+	if mode.unescape {
+		if unescaped, err := url.PathUnescape(component); err == nil {
+			component = unescaped
+		}
+	}
+	keys := []string{}
+	if _, ok := r.children[component]; ok {
+		keys = append(keys, component)
+	}
+	if !mode.foldCase {
+		return keys
+	}
+	folded := []string{}
+	for key := range r.children {
+		if key != component && strings.EqualFold(key, component) {
+			folded = append(folded, key)
+		}
+	}
+	sort.Strings(folded)
+	return append(keys, folded...)
+}
+
+// Gets the spelling of the static child's key that fits into the path, given
+// the path component that matched it. The component itself is kept if it
+// matched exactly, so that nothing is escaped differently than it was.
+func (mode matchMode) spell(key, component string) string {
+	if !mode.unescape {
+		return key
+	}
+	if unescaped, err := url.PathUnescape(component); err == nil &&
+		unescaped == key {
+		return component
+	}
+	return url.PathEscape(key)
+}
+
+// Values in the routes tree that only accept some of the paths that lead to
+// them, depending on what is left of the path after walking down to them.
+type remainderAcceptor interface {
+	accepts(remainder string) bool
+}
+
+// Decides whether the value that was walked down to accepts the rest of the
+// path. Lookups can be more picky than acceptsRemainder, for instance about
+// the method of the request.
+type acceptor func(value interface{}, remainder string) bool
+
+// The acceptor that lookups use, unless they are told otherwise. Values that
+// can't tell accept everything, as long as they are there.
+func acceptsRemainder(value interface{}, remainder string) bool {
+	if value == nil {
+		return false
+	}
+	if a, ok := value.(remainderAcceptor); ok {
+		return a.accepts(remainder)
+	}
+	return true
+}
+
+// Determines whether the value that was walked down to accepts the rest of the
+// path.
+func (r PartialRouteNodeResult) accepted(accept acceptor) bool {
+	return accept(r.Value, joinRemainder(r.Remainder))
+}
+
+// getPartial walks down the tree, looking for the deepest value that accepts
+// the rest of the path. At every node, the candidates are tried in order of
+// precedence:
+//
+//  1. the static child that matches the next component,
+//  2. the parameter children that accept the next component, constrained ones
+//     first,
+//  3. the node's own value, which is where a wildcard route ending at the node
+//     lives.
+//
+// A candidate is abandoned as soon as the acceptor accepts nothing below it,
+// in which case the walk backtracks to the next candidate. That way, a
+// wildcard higher up the tree still catches the requests that dead-end in a
+// deeper branch.
+func (r *routeNode) getPartial(
+	components []string,
+	mode matchMode,
+	accept acceptor,
+) PartialRouteNodeResult {
 	if len(components) <= 0 {
 		return PartialRouteNodeResult{
 			Retrieved: true,
@@ -102,18 +391,59 @@ func (r *routeNode) getPartial(components []string) PartialRouteNodeResult {
 		}
 	}
 	first, remainder := components[0], components[1:]
-	if r.childOrChildren.IsChildOnly() {
-		return r.childOrChildren.child.getPartial(remainder)
+	for _, key := range r.staticKeys(first, mode) {
+		result := r.children[key].getPartial(remainder, mode, accept)
+		if result.accepted(accept) {
+			if mode.foldCase {
+				result.Path = append(
+					[]string{mode.spell(key, first)},
+					result.Path...,
+				)
+			}
+			return result
+		}
 	}
-	node, ok := (*r.childOrChildren.children)[first]
-	if !ok {
-		return PartialRouteNodeResult{
-			Retrieved: true,
-			Value:     r.value,
-			Remainder: remainder,
+	for _, param := range r.params {
+		if !param.accepts(first) {
+			continue
+		}
+		result := param.getPartial(remainder, mode, accept)
+		if result.accepted(accept) {
+			if mode.foldCase {
+				result.Path = append([]string{first}, result.Path...)
+			}
+			return result
 		}
 	}
-	return node.getPartial(remainder)
+	return PartialRouteNodeResult{
+		Retrieved: true,
+		Value:     r.value,
+		Remainder: components,
+	}
+}
+
+// candidates calls the function with every value that getPartial could end up
+// with, whether or not it accepts the rest of the path, in the order in which
+// getPartial tries them.
+func (r *routeNode) candidates(
+	components []string,
+	mode matchMode,
+	fn func(value interface{}, remainder []string),
+) {
+	if len(components) > 0 {
+		first, remainder := components[0], components[1:]
+		for _, key := range r.staticKeys(first, mode) {
+			r.children[key].candidates(remainder, mode, fn)
+		}
+		for _, param := range r.params {
+			if param.accepts(first) {
+				param.candidates(remainder, mode, fn)
+			}
+		}
+	}
+	if r.value != nil {
+		fn(r.value, components)
+	}
 }
 
 // routes get the routes.
@@ -121,21 +451,19 @@ type routes struct {
 	children map[string]routeNode
 }
 
-// add adds a new route.
+// add adds a new route. An empty route refers to the root of the tree, which
+// is where the wildcard route `/*` lives.
 func (r *routes) add(route string, value interface{}) error {
-	if len(route) <= 0 {
-		return errors.New("Route cannot be empty")
-	}
-
 	components := strings.Split(route, "/")
 	first, remainder := components[0], components[1:]
 	node, ok := r.children[first]
 	if !ok {
-		r.children[first] = newRouteNode(remainder, value)
-	} else {
-		node.add(remainder, value)
+		node = newRouteNode()
 	}
-
+	if err := node.add(remainder, value); err != nil {
+		return err
+	}
+	r.children[first] = node
 	return nil
 }
 
@@ -153,6 +481,60 @@ func (r routes) get(route string) interface{} {
 	return node.get(remainder)
 }
 
+// find gets the value that was added under the exact same route pattern.
+func (r routes) find(route string) interface{} {
+	components := strings.Split(route, "/")
+	first, remainder := components[0], components[1:]
+
+	node, ok := r.children[first]
+	if !ok {
+		return nil
+	}
+	return node.find(remainder)
+}
+
+// remove removes the value that was added under the exact same route pattern.
+// See routeNode.remove.
+func (r *routes) remove(route string) bool {
+	components := strings.Split(route, "/")
+	first, remainder := components[0], components[1:]
+
+	node, ok := r.children[first]
+	if !ok {
+		return false
+	}
+	removed := node.remove(remainder)
+	if node.empty() {
+		delete(r.children, first)
+	} else {
+		r.children[first] = node
+	}
+	return removed
+}
+
+// walk calls the function with every value in the tree.
+func (r routes) walk(fn func(value interface{})) {
+	keys := make([]string, 0, len(r.children))
+	for key := range r.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		node := r.children[key]
+		node.walk(fn)
+	}
+}
+
+// clone copies the top of the tree, which is all that it takes for add and
+// remove to leave the original tree alone. See routeNode.add.
+func (r routes) clone() *routes {
+	tree := routes{make(map[string]routeNode, len(r.children))}
+	for key, node := range r.children {
+		tree.children[key] = node
+	}
+	return &tree
+}
+
 func newRouter() routes {
 	return routes{make(map[string]routeNode)}
 }
@@ -161,11 +543,25 @@ type partialRouteResult struct {
 	retrieved bool
 	value     interface{}
 	remainder string
+
+	// Only when folding case. The path that was matched, with static components
+	// spelled the way they were added.
+	canonical string
 }
 
 // Let's say we only have a handler registered at /foo/bar, but we request a
 // handler at /foo/bar/baz, then we will still get the handler at /foo/bar.
 func (r routes) getShortCircuited(route string) partialRouteResult {
+	return r.getShortCircuitedWith(route, matchMode{}, acceptsRemainder)
+}
+
+// Same as getShortCircuited, except that the static components are compared
+// the way the mode says, and the value has to be accepted by the acceptor.
+func (r routes) getShortCircuitedWith(
+	route string,
+	mode matchMode,
+	accept acceptor,
+) partialRouteResult {
 	if len(route) <= 0 {
 		return partialRouteResult{}
 	}
@@ -180,18 +576,61 @@ func (r routes) getShortCircuited(route string) partialRouteResult {
 		}
 	}
 
-	result := node.getPartial(remainder)
+	result := node.getPartial(remainder, mode, accept)
 	if !result.Retrieved {
 		return partialRouteResult{
 			retrieved: false,
 			value:     nil,
-			remainder: "/" + strings.Join(result.Remainder, "/"),
+			remainder: joinRemainder(result.Remainder),
+		}
+	}
+
+	var canonical string
+	if mode.foldCase {
+		canonical = joinRemainder(result.Path) + joinRemainder(result.Remainder)
+		if len(canonical) <= 0 {
+			canonical = "/"
 		}
 	}
 
 	return partialRouteResult{
 		retrieved: true,
 		value:     result.Value,
-		remainder: "/" + strings.Join(result.Remainder, "/"),
+		remainder: joinRemainder(result.Remainder),
+		canonical: canonical,
+	}
+}
+
+// candidates calls the function with every value in the tree that a lookup of
+// the route could end up with, along with the rest of the route. See
+// routeNode.candidates.
+func (r routes) candidates(
+	route string,
+	mode matchMode,
+	fn func(value interface{}, remainder string),
+) {
+	if len(route) <= 0 {
+		return
+	}
+	components := strings.Split(route, "/")
+	node, ok := r.children[components[0]]
+	if !ok {
+		return
+	}
+	node.candidates(
+		components[1:],
+		mode,
+		func(value interface{}, remainder []string) {
+			fn(value, joinRemainder(remainder))
+		},
+	)
+}
+
+// Turns the components that were not consumed by the routes tree back into a
+// path. If every component was consumed, then the remainder is empty.
+func joinRemainder(components []string) string {
+	if len(components) <= 0 {
+		return ""
 	}
+	return "/" + strings.Join(components, "/")
 }
@@ -78,3 +78,256 @@ func TestPartialGet(t *testing.T) {
 		t.Error("Expected foobar to be 20")
 	}
 }
+
+func TestStaticAfterParam(t *testing.T) {
+	router := newRouter()
+	router.add("/users/:id", 10)
+	router.add("/users/me", 20)
+
+	id, ok := router.get("/users/42").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if id != 10 {
+		t.Error("Expected id to be 10")
+	}
+
+	me, ok := router.get("/users/me").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if me != 20 {
+		t.Error("Expected me to be 20")
+	}
+}
+
+func TestParamAfterStatic(t *testing.T) {
+	router := newRouter()
+	router.add("/users/me", 20)
+	router.add("/users/:id", 10)
+
+	id, ok := router.get("/users/42").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if id != 10 {
+		t.Error("Expected id to be 10")
+	}
+
+	me, ok := router.get("/users/me").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if me != 20 {
+		t.Error("Expected me to be 20")
+	}
+}
+
+func TestStaticAndParamSubtrees(t *testing.T) {
+	router := newRouter()
+	router.add("/users/:id/posts", 10)
+	router.add("/users/me/settings", 20)
+
+	posts, ok := router.get("/users/42/posts").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if posts != 10 {
+		t.Error("Expected posts to be 10")
+	}
+
+	// Since "me" has no posts of its own, the parameter should pick it up.
+	posts, ok = router.get("/users/me/posts").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if posts != 10 {
+		t.Error("Expected posts to be 10")
+	}
+
+	settings, ok := router.get("/users/me/settings").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if settings != 20 {
+		t.Error("Expected settings to be 20")
+	}
+
+	if router.get("/users/42/settings") != nil {
+		t.Error("Expected /users/42/settings to not exist")
+	}
+}
+
+func TestFind(t *testing.T) {
+	router := newRouter()
+	router.add("/users/:id", 10)
+
+	id, ok := router.find("/users/:id").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if id != 10 {
+		t.Error("Expected id to be 10")
+	}
+
+	if router.find("/users/me") != nil {
+		t.Error("Expected /users/me to not be found")
+	}
+}
+
+func TestParamNameAliasesShareNode(t *testing.T) {
+	router := newRouter()
+	if err := router.add("/users/:id", 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.add("/users/:userID/posts", 20); err != nil {
+		t.Fatal(err)
+	}
+
+	if router.get("/users/42") != 10 {
+		t.Error("Expected /users/42 to be 10")
+	}
+	if router.get("/users/42/posts") != 20 {
+		t.Error("Expected /users/42/posts to be 20")
+	}
+	if router.find("/users/:userID") != 10 {
+		t.Error("Expected /users/:userID to find the same node as /users/:id")
+	}
+}
+
+func TestConstrainedParams(t *testing.T) {
+	router := newRouter()
+	router.add("/users/:name", 10)
+	router.add("/users/:id{int}", 20)
+	router.add("/files/:name{[a-z]+\\.txt}", 30)
+
+	name, ok := router.get("/users/foo").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if name != 10 {
+		t.Error("Expected name to be 10")
+	}
+
+	id, ok := router.get("/users/42").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if id != 20 {
+		t.Error("Expected id to be 20")
+	}
+
+	file, ok := router.get("/files/notes.txt").(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if file != 30 {
+		t.Error("Expected file to be 30")
+	}
+
+	if router.get("/files/notes.pdf") != nil {
+		t.Error("Expected /files/notes.pdf to not exist")
+	}
+}
+
+func TestInvalidConstraint(t *testing.T) {
+	router := newRouter()
+	if err := router.add("/users/:id{[0-9}", 10); err == nil {
+		t.Error("Expected the invalid constraint to be rejected")
+	}
+}
+
+func TestCaseInsensitiveGet(t *testing.T) {
+	router := newRouter()
+	router.add("/Foo/:bar", 10)
+
+	result := router.getShortCircuitedWith(
+		"/FOO/Baz",
+		matchMode{foldCase: true},
+		acceptsRemainder,
+	)
+	foo, ok := result.value.(int)
+	if !ok {
+		t.Error("Not an integer")
+	}
+	if foo != 10 {
+		t.Error("Expected foo to be 10")
+	}
+	if result.canonical != "/Foo/Baz" {
+		t.Errorf("Expected the canonical path to be /Foo/Baz, but got %s", result.canonical)
+	}
+
+	if router.getShortCircuited("/FOO/Baz").value != nil {
+		t.Error("Expected /FOO/Baz to not exist when matching case")
+	}
+}
+
+func TestRemoveAndPrune(t *testing.T) {
+	router := newRouter()
+	router.add("/foo", 10)
+	router.add("/foo/bar/baz", 20)
+	router.add("/foo/:id/qux", 30)
+
+	if !router.remove("/foo/bar/baz") {
+		t.Error("Expected /foo/bar/baz to be removed")
+	}
+	if router.remove("/foo/bar/baz") {
+		t.Error("Expected /foo/bar/baz to have already been removed")
+	}
+	if router.remove("/foo/bar") {
+		t.Error("Expected /foo/bar to not have a value to remove")
+	}
+	if router.get("/foo/bar/baz") != nil {
+		t.Error("Expected /foo/bar/baz to be gone")
+	}
+
+	root := router.children[""]
+	if _, ok := root.children["foo"].children["bar"]; ok {
+		t.Error("Expected the empty /foo/bar node to be pruned")
+	}
+
+	if !router.remove("/foo/:name/qux") {
+		t.Error("Expected /foo/:id/qux to be removed")
+	}
+	root = router.children[""]
+	if len(root.children["foo"].params) > 0 {
+		t.Error("Expected the empty /foo/:id node to be pruned")
+	}
+
+	if router.get("/foo") != 10 {
+		t.Error("Expected /foo to be left alone")
+	}
+	if !router.remove("/foo") {
+		t.Error("Expected /foo to be removed")
+	}
+	if len(router.children) > 0 {
+		t.Error("Expected the whole tree to be pruned")
+	}
+}
+
+// A value that only accepts the path that leads exactly to it.
+type exactValue int
+
+func (v exactValue) accepts(remainder string) bool {
+	return len(remainder) <= 0
+}
+
+func TestPartialGetBacktracks(t *testing.T) {
+	router := newRouter()
+	router.add("/users", 10)
+	router.add("/users/me", exactValue(20))
+	router.add("/users/:id/posts", exactValue(30))
+
+	result := router.getShortCircuited("/users/me/posts")
+	if result.value != exactValue(30) {
+		t.Errorf("Expected /users/me/posts to backtrack to 30, but got %v", result.value)
+	}
+
+	result = router.getShortCircuited("/users/me/likes")
+	if result.value != 10 {
+		t.Errorf("Expected /users/me/likes to fall back to 10, but got %v", result.value)
+	}
+	if result.remainder != "/me/likes" {
+		t.Errorf("Expected the remainder to be /me/likes, but got %s", result.remainder)
+	}
+}
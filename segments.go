@@ -0,0 +1,239 @@
+package muxer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A part of a path component, which is either literal text, or a parameter.
+type segmentPart struct {
+	literal    string
+	param      bool
+	name       string
+	constraint string
+}
+
+// Determines whether the byte can be a part of a parameter's name. A parameter
+// in the middle of a path component ends at the first byte that can't be.
+func isNameByte(c byte) bool {
+	return c == '_' ||
+		'a' <= c && c <= 'z' ||
+		'A' <= c && c <= 'Z' ||
+		'0' <= c && c <= '9'
+}
+
+// Gets the index of the brace that closes the one at the start index, or -1 if
+// it is never closed.
+func closingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Splits a path component into literal text and parameters, as in
+// `:name.:ext`, `v:version` or `@:username`. A parameter's name is made of
+// letters, digits and underscores, and it can be followed by a constraint in
+// braces, as in `:id{int}.json`.
+func parseSegment(component string) []segmentPart {
+	parts := []segmentPart{}
+	for len(component) > 0 {
+		colon := strings.IndexByte(component, ':')
+		if colon != 0 {
+			if colon < 0 {
+				colon = len(component)
+			}
+			parts = append(parts, segmentPart{literal: component[:colon]})
+			component = component[colon:]
+			continue
+		}
+
+		end := 1
+		for end < len(component) && isNameByte(component[end]) {
+			end++
+		}
+		part := segmentPart{param: true, name: component[1:end]}
+		if end < len(component) && component[end] == '{' {
+			if closing := closingBrace(component, end); closing >= 0 {
+				part.constraint = component[end+1 : closing]
+				end = closing + 1
+			}
+		}
+		parts = append(parts, part)
+		component = component[end:]
+	}
+	return parts
+}
+
+// Determines whether the path component mixes literal text with parameters, or
+// holds several parameters, rather than being a single parameter, such as
+// `:id`, or just literal text.
+func isMixed(component string) bool {
+	parts := parseSegment(component)
+	if len(parts) == 1 && parts[0].param {
+		return false
+	}
+	for _, part := range parts {
+		if part.param {
+			return true
+		}
+	}
+	return false
+}
+
+// Determines whether the path component captures anything, whether as a
+// whole, or in parts.
+func isCapturing(component string) bool {
+	return isParam(component) || isMixed(component)
+}
+
+// Gets what tells the parameter children of a node apart, which is the shape of
+// the path component with the names of its parameters left out. For instance,
+// both `:name.:ext` and `:base.:format` have the shape `:.:`, while `:id{int}`
+// has the shape `:{int}`.
+func captureKey(component string) string {
+	if isParam(component) {
+		_, constraint := parseParam(component)
+		if len(constraint) <= 0 {
+			return ":"
+		}
+		return ":{" + constraint + "}"
+	}
+	var key strings.Builder
+	for _, part := range parseSegment(component) {
+		if !part.param {
+			key.WriteString(part.literal)
+			continue
+		}
+		key.WriteString(":")
+		if len(part.constraint) > 0 {
+			key.WriteString("{" + part.constraint + "}")
+		}
+	}
+	return key.String()
+}
+
+// Compiles the regular expression that the whole path component has to match.
+// Nil if the component is a parameter without a constraint, which matches
+// anything.
+func compileCapture(component string) (*regexp.Regexp, error) {
+	if isParam(component) {
+		_, constraint := parseParam(component)
+		if len(constraint) <= 0 {
+			return nil, nil
+		}
+		return compileConstraint(constraint)
+	}
+
+	// Every parameter captures at least one byte, and as few as it takes for
+	// the rest of the component to match.
+	var expression strings.Builder
+	expression.WriteString("^")
+	for i, part := range parseSegment(component) {
+		if !part.param {
+			expression.WriteString(regexp.QuoteMeta(part.literal))
+			continue
+		}
+		pattern := ".+?"
+		if len(part.constraint) > 0 {
+			pattern = part.constraint
+			if named, ok := namedConstraints[pattern]; ok {
+				pattern = named
+			}
+		}
+		fmt.Fprintf(&expression, "(?P<p%d>%s)", i, pattern)
+	}
+	expression.WriteString("$")
+
+	regex, err := regexp.Compile(expression.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid segment %s: %s", component, err)
+	}
+	return regex, nil
+}
+
+// Captures the values of the parameters in one of the components of a route.
+type segmentCapture struct {
+	// The position of the component in the route.
+	index int
+
+	// The names of the parameters, along with the groups of the regular
+	// expression that capture them. The regular expression is nil if the
+	// component is a single parameter, which captures the whole component.
+	names  []string
+	groups []int
+	regex  *regexp.Regexp
+}
+
+// Compiles the captures for every component of the route that has parameters.
+func compileCaptures(route string) ([]segmentCapture, error) {
+	captures := []segmentCapture{}
+	for i, component := range routeComponents(route) {
+		if isParam(component) {
+			name, _ := parseParam(component)
+			captures = append(captures, segmentCapture{
+				index: i,
+				names: []string{name},
+			})
+			continue
+		}
+		if !isMixed(component) {
+			continue
+		}
+
+		regex, err := compileCapture(component)
+		if err != nil {
+			return nil, err
+		}
+		capture := segmentCapture{index: i, regex: regex}
+		for j, part := range parseSegment(component) {
+			if !part.param {
+				continue
+			}
+			capture.names = append(capture.names, part.name)
+			capture.groups = append(
+				capture.groups,
+				subexpIndex(regex, fmt.Sprintf("p%d", j)),
+			)
+		}
+		captures = append(captures, capture)
+	}
+	return captures, nil
+}
+
+// Gets the index of the regular expression's group with the given name.
+func subexpIndex(regex *regexp.Regexp, name string) int {
+	for i, subexp := range regex.SubexpNames() {
+		if subexp == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Gets the values of the parameters in the path component, keyed by the
+// parameters' names. Nil if the component doesn't match.
+func (c segmentCapture) values(component string) map[string]string {
+	if c.regex == nil {
+		return map[string]string{c.names[0]: component}
+	}
+	matches := c.regex.FindStringSubmatch(component)
+	if matches == nil {
+		return nil
+	}
+	values := make(map[string]string, len(c.names))
+	for i, name := range c.names {
+		values[name] = matches[c.groups[i]]
+	}
+	return values
+}
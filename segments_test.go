@@ -0,0 +1,50 @@
+package muxer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCaptureKey(t *testing.T) {
+	for _, test := range []struct {
+		component string
+		expected  string
+	}{
+		{":id", ":"},
+		{":id{int}", ":{int}"},
+		{":name.:ext", ":.:"},
+		{":base.:format", ":.:"},
+		{"v:version", "v:"},
+		{"@:username", "@:"},
+		{":id{[0-9]{2}}.json", ":{[0-9]{2}}.json"},
+	} {
+		if key := captureKey(test.component); key != test.expected {
+			t.Errorf("Key of %s is unexpected: want %v, but got %v", test.component, test.expected, key)
+		}
+	}
+}
+
+func TestSegmentCaptures(t *testing.T) {
+	for _, test := range []struct {
+		route     string
+		component string
+		expected  map[string]string
+	}{
+		{"/:name.:ext", "notes.txt", map[string]string{"name": "notes", "ext": "txt"}},
+		{"/:name.:ext", "archive.tar.gz", map[string]string{"name": "archive", "ext": "tar.gz"}},
+		{"/:name.:ext", "README", nil},
+		{"/v:version", "v2", map[string]string{"version": "2"}},
+		{"/v:version{int}", "vNext", nil},
+		{"/@:username", "@gopher", map[string]string{"username": "gopher"}},
+		{"/:id", "42", map[string]string{"id": "42"}},
+	} {
+		captures, err := compileCaptures(test.route)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := captures[0].values(test.component)
+		if !reflect.DeepEqual(values, test.expected) {
+			t.Errorf("Values of %s in %s are unexpected: want %v, but got %v", test.component, test.route, test.expected, values)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package muxer
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Name gives a name to a route that has already been added to the muxer, so
+// that URLs pointing to the route can be built using URL.
+func (m *Muxer) Name(name, route string) error {
+	return m.name(m.routes, name, route)
+}
+
+func (m *Muxer) name(table *routeTable, name, route string) error {
+	if err := validatePath(route); err != nil {
+		return err
+	}
+	registered, err := isRegistered(table, route)
+	if err != nil {
+		return err
+	}
+	if !registered {
+		return fmt.Errorf("route %s has not been added", route)
+	}
+	if existing, ok := m.names[name]; ok && existing.route != route {
+		return fmt.Errorf(
+			"name %s has already been given to route %s",
+			name,
+			existing.route,
+		)
+	}
+	m.names[name] = namedRoute{route, table}
+	return nil
+}
+
+// A route that was given a name, along with the routes table that it was added
+// to.
+type namedRoute struct {
+	route  string
+	routes *routeTable
+}
+
+// Determines whether anything has been added to the route in the table, and
+// not removed since. The route has to be spelled the way it was added.
+func isRegistered(table *routeTable, route string) (bool, error) {
+	expansions, err := expandOptional(route)
+	if err != nil {
+		return false, err
+	}
+	path := extractRelevantPath(expansions[0])
+	handler, ok := table.load().find(path).(*routeHandler)
+	return ok && handler.hasPattern(route), nil
+}
+
+// URL builds the path for the route that was given the name, by substituting
+// every parameter in the route with its value. The values are supplied as
+// pairs of parameter names and values, e.g.
+//
+//	mux.URL("user.show", "id", "42")
+//
+// The value that should stand in place of a trailing wildcard can be supplied
+// under the wildcard's name, or under "*" if it has none. Every parameter must
+// be supplied, and no other, with the exception of the wildcard.
+func (m Muxer) URL(name string, pairs ...string) (string, error) {
+	named, ok := m.names[name]
+	if !ok {
+		return "", fmt.Errorf("no route has been given the name %s", name)
+	}
+	// Routes can be removed after they were given a name, in which case there is
+	// nothing left for the URL to point to.
+	route := named.route
+	registered, err := isRegistered(named.routes, route)
+	if err != nil {
+		return "", err
+	}
+	if !registered {
+		return "", fmt.Errorf(
+			"route %s, which was given the name %s, has been removed",
+			route,
+			name,
+		)
+	}
+	if len(pairs)%2 != 0 {
+		return "", errors.New("parameters must be supplied in name and value pairs")
+	}
+
+	params := make(map[string]string)
+	for i := 0; i < len(pairs); i += 2 {
+		if _, ok := params[pairs[i]]; ok {
+			return "", fmt.Errorf("parameter %s was supplied more than once", pairs[i])
+		}
+		params[pairs[i]] = pairs[i+1]
+	}
+
+	// Optional parts are left out of the path when none of their parameters
+	// were supplied.
+	expansions, err := expandOptional(route)
+	if err != nil {
+		return "", err
+	}
+	var firstErr error
+	for _, expansion := range expansions {
+		path, err := buildPath(expansion, params)
+		if err == nil {
+			return path, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return "", firstErr
+}
+
+// Builds a path out of a route pattern, consuming the supplied parameters.
+func buildPath(route string, params map[string]string) (string, error) {
+	components := routeComponents(route)
+	used := make(map[string]bool)
+	for i, component := range components {
+		if !isCapturing(component) {
+			continue
+		}
+		var built strings.Builder
+		for _, part := range parseSegment(component) {
+			if !part.param {
+				built.WriteString(part.literal)
+				continue
+			}
+			value, ok := params[part.name]
+			if !ok {
+				return "", fmt.Errorf("parameter %s is missing", part.name)
+			}
+			if len(part.constraint) > 0 {
+				regex, err := compileConstraint(part.constraint)
+				if err != nil {
+					return "", err
+				}
+				if !regex.MatchString(value) {
+					return "", fmt.Errorf(
+						"parameter %s does not satisfy the constraint %s",
+						part.name,
+						part.constraint,
+					)
+				}
+			}
+			built.WriteString(url.PathEscape(value))
+			used[part.name] = true
+		}
+		components[i] = built.String()
+	}
+
+	if pathHasWildcard(route) {
+		name := wildcardName(route)
+		if len(name) <= 0 {
+			name = "*"
+		}
+		if value, ok := params[name]; ok {
+			for _, component := range strings.Split(value, "/") {
+				components = append(components, url.PathEscape(component))
+			}
+			used[name] = true
+		}
+	}
+
+	for name := range params {
+		if !used[name] {
+			return "", fmt.Errorf("parameter %s is not part of route %s", name, route)
+		}
+	}
+
+	return "/" + strings.Join(components, "/"), nil
+}
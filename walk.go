@@ -0,0 +1,128 @@
+package muxer
+
+import (
+	"net/http"
+	"strings"
+)
+
+// WalkFunc is the type of the function that is called for every route visited
+// by Walk. The method is empty for handlers that were added for any method.
+//
+// If the function returns an error, then walking stops, and Walk returns that
+// same error.
+type WalkFunc func(method, route string, h http.Handler) error
+
+// Route describes a route that has been added to a muxer.
+type Route struct {
+	// Empty if the route was not added for a specific host.
+	Host string
+
+	Pattern string
+
+	// Empty if the route's handler was added for any method.
+	Methods []string
+}
+
+// Called for every route, along with the host that the route was added for.
+type hostWalkFunc func(host, method, route string, h http.Handler) error
+
+// Walk calls the function for every handler that has been added to the muxer.
+// Rather than being visited themselves, muxers that are mounted inside this one
+// have their own routes visited, with the mount point prepended to them.
+//
+// Routes that were added for a specific host are visited first, with the host
+// pattern prepended to them, as in `{tenant}.example.com/users`.
+func (m Muxer) Walk(fn WalkFunc) error {
+	return m.walk(
+		"",
+		"",
+		func(host, method, route string, h http.Handler) error {
+			return fn(method, host+route, h)
+		},
+	)
+}
+
+func (m Muxer) walk(host, prefix string, fn hostWalkFunc) error {
+	for _, hostRoutes := range m.hosts {
+		err := m.walkTree(hostRoutes.routes, hostRoutes.pattern, prefix, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return m.walkTree(m.routes, host, prefix, fn)
+}
+
+func (m Muxer) walkTree(
+	table *routeTable,
+	host, prefix string,
+	fn hostWalkFunc,
+) error {
+	var err error
+	visit := func(method string, h wrappedHandler) {
+		if err != nil || h.alias {
+			return
+		}
+		route := joinRoutes(prefix, h.pattern)
+		original := h.original
+		if stripped, ok := original.(strippedHandler); ok {
+			original = stripped.handler
+		}
+		switch mounted := original.(type) {
+		case Muxer:
+			err = mounted.walk(host, extractRelevantPath(route), fn)
+		case *Muxer:
+			err = mounted.walk(host, extractRelevantPath(route), fn)
+		default:
+			err = fn(host, method, route, original)
+		}
+	}
+
+	table.load().walk(func(value interface{}) {
+		handler, ok := value.(*routeHandler)
+		if !ok {
+			return
+		}
+		for _, method := range handler.allowedMethods("") {
+			for _, h := range (*handler)[method] {
+				visit(method, h)
+			}
+		}
+		for _, h := range (*handler)[anyMethod] {
+			visit(anyMethod, h)
+		}
+	})
+
+	return err
+}
+
+// Puts the route of a mounted muxer under the route that it was mounted at.
+func joinRoutes(prefix, route string) string {
+	if len(prefix) <= 0 {
+		return route
+	}
+	if route == "/" {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + route
+}
+
+// Routes gets every route that has been added to the muxer, including the
+// routes of the muxers mounted inside it.
+func (m Muxer) Routes() []Route {
+	routes := []Route{}
+	indices := make(map[string]int)
+	add := func(host, method, route string, h http.Handler) error {
+		i, ok := indices[host+route]
+		if !ok {
+			i = len(routes)
+			indices[host+route] = i
+			routes = append(routes, Route{Host: host, Pattern: route})
+		}
+		if len(method) > 0 && !contains(routes[i].Methods, method) {
+			routes[i].Methods = append(routes[i].Methods, method)
+		}
+		return nil
+	}
+	m.walk("", "", add)
+	return routes
+}